@@ -0,0 +1,101 @@
+package yaml
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// blankLineMarks records the marker comments that stand in for the blank lines
+// between block sequence items while the document is encoded, since the
+// encoder drops blank lines.
+type blankLineMarks struct {
+	prefix string
+}
+
+// markBlankLines puts a marker head comment on every block sequence item that
+// is preceded by blank lines in content. Items keep their nodes through an
+// update, so the marks survive as long as the item is not removed; items added
+// by the update never get blank lines.
+func markBlankLines(content []byte, root *yaml.Node) *blankLineMarks {
+	marks := &blankLineMarks{prefix: "__yammy_blank_"}
+	for bytes.Contains(content, []byte(marks.prefix)) {
+		marks.prefix = "_" + marks.prefix
+	}
+
+	lines := bytes.Split(content, []byte("\n"))
+	found := false
+	var walk func(node *yaml.Node)
+	walk = func(node *yaml.Node) {
+		if node.Kind == yaml.SequenceNode && node.Style&yaml.FlowStyle == 0 {
+			for _, item := range node.Content[min(1, len(node.Content)):] {
+				if n := blankLinesAbove(lines, item.Line-1); n > 0 {
+					mark := "# " + marks.prefix + strconv.Itoa(n)
+					if item.HeadComment != "" {
+						mark += "\n" + item.HeadComment
+					}
+					item.HeadComment = mark
+					found = true
+				}
+			}
+		}
+		for _, child := range node.Content {
+			walk(child)
+		}
+	}
+	walk(root)
+
+	if !found {
+		return nil
+	}
+	return marks
+}
+
+// blankLinesAbove counts the blank lines right above line, looking past the
+// comment lines directly above it.
+func blankLinesAbove(lines [][]byte, line int) int {
+	i := line - 1
+	for i >= 0 && bytes.HasPrefix(bytes.TrimSpace(lines[i]), []byte("#")) {
+		i--
+	}
+	n := 0
+	for ; i >= 0 && len(bytes.TrimSpace(lines[i])) == 0; i-- {
+		n++
+	}
+	if i < 0 {
+		return 0
+	}
+	return n
+}
+
+// unmark removes the marker comment from node, for an item that became the
+// first of its sequence and so has no item above to be separated from.
+func (m *blankLineMarks) unmark(node *yaml.Node) {
+	if !strings.HasPrefix(node.HeadComment, "# "+m.prefix) {
+		return
+	}
+	_, rest, _ := strings.Cut(node.HeadComment, "\n")
+	node.HeadComment = rest
+}
+
+// restore replaces the marker comments in encoded content with the blank lines
+// they stand for.
+func (m *blankLineMarks) restore(content []byte) []byte {
+	lines := bytes.Split(content, []byte("\n"))
+	out := make([][]byte, 0, len(lines))
+	for _, line := range lines {
+		text := strings.TrimSpace(string(line))
+		if count, ok := strings.CutPrefix(text, "# "+m.prefix); ok {
+			if n, err := strconv.Atoi(count); err == nil {
+				for ; n > 0; n-- {
+					out = append(out, nil)
+				}
+				continue
+			}
+		}
+		out = append(out, line)
+	}
+	return bytes.Join(out, []byte("\n"))
+}
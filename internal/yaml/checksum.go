@@ -0,0 +1,40 @@
+package yaml
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+)
+
+// checksumLine matches the foot comment written by Options.AppendChecksum.
+var checksumLine = regexp.MustCompile(`(?m)^# sha256: ([0-9a-f]{64})\n?\z`)
+
+// appendChecksum appends a "# sha256: <hash>" line holding the SHA-256 of
+// content, which must not carry a checksum line already.
+func appendChecksum(content []byte) []byte {
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		content = append(content, '\n')
+	}
+	sum := sha256.Sum256(content)
+	return append(content, "# sha256: "+hex.EncodeToString(sum[:])+"\n"...)
+}
+
+// stripChecksum removes the checksum line appendChecksum added, if any.
+func stripChecksum(content []byte) []byte {
+	if loc := checksumLine.FindIndex(content); loc != nil {
+		return content[:loc[0]]
+	}
+	return content
+}
+
+// VerifyChecksum reports whether content ends with a checksum line written by
+// Options.AppendChecksum that matches the rest of the content.
+func VerifyChecksum(content []byte) bool {
+	match := checksumLine.FindSubmatchIndex(content)
+	if match == nil {
+		return false
+	}
+	sum := sha256.Sum256(content[:match[0]])
+	return bytes.Equal([]byte(hex.EncodeToString(sum[:])), content[match[2]:match[3]])
+}
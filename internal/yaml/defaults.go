@@ -0,0 +1,69 @@
+package yaml
+
+import (
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FillDefaults adds the keys of data that are missing from content and never
+// changes values already present in the document. Nested structs are filled
+// recursively. For a missing key, a zero-valued field with a `default:"..."`
+// tag is written with its default instead; the tag value is parsed as YAML
+// into the field's type, e.g. `default:"8080"` or `default:"[a, b]"`.
+// opts tune the update as for UpdateYAML.
+func FillDefaults(content []byte, data interface{}, opts ...Option) ([]byte, error) {
+	options := newOptions(opts)
+	u := newUpdater(options)
+	u.fillOnly = true
+	result, err := u.updateDocument(content, data)
+	if err != nil {
+		return nil, err
+	}
+	logWarnings(result, options)
+	return result.Content, nil
+}
+
+// MissingKeys returns the dotted paths of the fields of data that have no key
+// in content, i.e. what FillDefaults would add. A missing struct is reported
+// once, without its fields. content is only read. opts tune how content is
+// read and matched as for UpdateYAML.
+func MissingKeys(content []byte, data interface{}, opts ...Option) ([]string, error) {
+	options := newOptions(opts)
+	doc, err := parseDocument(content, options)
+	if err != nil {
+		return nil, err
+	}
+
+	u := newUpdater(options)
+	u.fillOnly = true
+	u.collectMissing = true
+	if err := u.update(doc, data); err != nil {
+		return nil, err
+	}
+	return u.missing, nil
+}
+
+// fillExisting descends into a value already present in the document so that
+// missing keys of nested structs get filled. Everything else is left alone.
+func (u *updater) fillExisting(node *yaml.Node, value reflect.Value) error {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	return u.updateYamlFromStruct(node, value.Interface())
+}
+
+// parseDefault decodes the YAML text of a `default` tag into a value of type typ.
+func parseDefault(def string, typ reflect.Type) (reflect.Value, error) {
+	ptr := reflect.New(typ)
+	if err := yaml.Unmarshal([]byte(def), ptr.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	return ptr.Elem(), nil
+}
@@ -0,0 +1,129 @@
+package yaml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFillDefaults(t *testing.T) {
+	type server struct {
+		Host    string   `yaml:"host" default:"localhost"`
+		Port    int      `yaml:"port" default:"8080"`
+		Origins []string `yaml:"origins" default:"[a, b]"`
+	}
+	type config struct {
+		Name   string `yaml:"name"`
+		Server server `yaml:"server"`
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		data    config
+		opts    []Option
+		want    string
+	}{
+		{
+			name:    "missing keys get defaults",
+			content: "name: app\n",
+			data:    config{Name: "other"},
+			want:    "name: app\nserver:\n  host: localhost\n  port: 8080\n  origins:\n    - a\n    - b\n",
+		},
+		{
+			name:    "present keys left untouched",
+			content: "name: app # keep\nserver:\n  port: 9090\n",
+			data:    config{Name: "other", Server: server{Port: 1}},
+			want:    "name: app # keep\nserver:\n  port: 9090\n  host: localhost\n  origins:\n    - a\n    - b\n",
+		},
+		{
+			name:    "comment-only document",
+			content: "# defaults only\n",
+			data:    config{Name: "app"},
+			want:    "# defaults only\n\nname: app\nserver:\n  host: localhost\n  port: 8080\n  origins:\n    - a\n    - b\n",
+		},
+		{
+			name:    "layout detected like UpdateYAML",
+			content: "\xef\xbb\xbfname: app\nserver:\n    port: 9090\n",
+			data:    config{},
+			want:    "\xef\xbb\xbfname: app\nserver:\n    port: 9090\n    host: localhost\n    origins:\n        - a\n        - b\n",
+		},
+		{
+			name:    "options",
+			content: "name: app\n",
+			data:    config{},
+			opts:    []Option{WithIndent(4)},
+			want:    "name: app\nserver:\n    host: localhost\n    port: 8080\n    origins:\n        - a\n        - b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := FillDefaults([]byte(tt.content), tt.data, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissingKeys(t *testing.T) {
+	content, _ := readTestPerson(t)
+
+	type contact struct {
+		Email string `yaml:"email"`
+		Phone string `yaml:"phone.mobile"`
+	}
+	type details struct {
+		City    string  `yaml:"city"`
+		Zip     string  `yaml:"zip"`
+		Contact contact `yaml:"contact"`
+	}
+	type person struct {
+		Name    string  `yaml:"name"`
+		Age     int     `yaml:"age"`
+		Email   string  `yaml:"email"`
+		Details details `yaml:"details"`
+	}
+
+	tests := []struct {
+		name    string
+		content []byte
+		opts    []Option
+		want    []string
+	}{
+		{
+			name:    "missing nested keys",
+			content: content,
+			want:    []string{"email", "details.zip", "details.contact"},
+		},
+		{
+			name:    "nothing missing",
+			content: []byte("name: a\nage: 1\nemail: b\ndetails:\n  city: c\n  zip: d\n  contact:\n    email: e\n    phone.mobile: f\n"),
+		},
+		{
+			name:    "dotted key",
+			content: []byte("name: a\nage: 1\nemail: b\ndetails:\n  city: c\n  zip: d\n  contact:\n    email: e\n"),
+			want:    []string{`details.contact["phone.mobile"]`},
+		},
+		{
+			name:    "key aliases count as present",
+			content: []byte("name: a\nage: 1\nmail: b\ndetails:\n  city: c\n  zip: d\n  contact: {email: e, phone.mobile: f}\n"),
+			opts:    []Option{WithKeyAlias("mail", "email")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missing, err := MissingKeys(tt.content, person{}, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(missing, tt.want) {
+				t.Errorf("got %q, want %q", missing, tt.want)
+			}
+		})
+	}
+}
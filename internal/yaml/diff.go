@@ -0,0 +1,104 @@
+package yaml
+
+import "gopkg.in/yaml.v3"
+
+// ExtractChanges applies data to original and returns a YAML document that
+// contains only the keys whose values differ from the original, keeping the
+// surrounding structure down to the changed leaves. The result is meant to be
+// used as a minimal overlay/patch file. opts tune the update as for UpdateYAML.
+func ExtractChanges(original []byte, data interface{}, opts ...Option) ([]byte, error) {
+	options := newOptions(opts)
+	before, after, err := updateCopy(original, data, options)
+	if err != nil {
+		return nil, err
+	}
+
+	delta := diffMapping(documentBody(&before.root), documentBody(&after.root))
+	after.root = yaml.Node{
+		Kind:    yaml.DocumentNode,
+		Content: []*yaml.Node{delta},
+	}
+
+	return after.encode(options)
+}
+
+// updateCopy parses content twice and applies data to the second tree only, so
+// the two can be compared without encoding anything. Template actions are
+// unmasked in both trees, so values compare and decode as written.
+func updateCopy(content []byte, data interface{}, opts Options) (before, after *parsedDocument, err error) {
+	if before, err = parseDocument(content, opts); err != nil {
+		return nil, nil, err
+	}
+	if after, err = parseDocument(content, opts); err != nil {
+		return nil, nil, err
+	}
+
+	if err := newUpdater(opts).update(after, data); err != nil {
+		return nil, nil, err
+	}
+	if before.templates != nil {
+		before.templates.unmaskNode(&before.root)
+		after.templates.unmaskNode(&after.root)
+	}
+
+	return before, after, nil
+}
+
+// documentBody returns the top-level content node of a parsed document, or the
+// node itself if it is not a document node.
+func documentBody(node *yaml.Node) *yaml.Node {
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		return node.Content[0]
+	}
+	return node
+}
+
+// diffMapping returns a mapping node holding the pairs of after that are new or
+// changed compared to before. Nested mappings are diffed recursively, every
+// other kind of value is emitted as a whole when it differs.
+func diffMapping(before, after *yaml.Node) *yaml.Node {
+	delta := &yaml.Node{
+		Kind:  yaml.MappingNode,
+		Tag:   "!!map",
+		Style: after.Style,
+	}
+
+	for i := 0; i+1 < len(after.Content); i += 2 {
+		keyNode, valueNode := after.Content[i], after.Content[i+1]
+
+		var oldValue *yaml.Node
+		if before.Kind == yaml.MappingNode {
+			_, oldValue, _ = findNodes(before, keyValue(keyNode))
+		}
+
+		switch {
+		case oldValue == nil:
+			delta.Content = append(delta.Content, keyNode, valueNode)
+		case oldValue.Kind == yaml.MappingNode && valueNode.Kind == yaml.MappingNode:
+			if sub := diffMapping(oldValue, valueNode); len(sub.Content) > 0 {
+				delta.Content = append(delta.Content, keyNode, sub)
+			}
+		case !nodesEqual(oldValue, valueNode):
+			delta.Content = append(delta.Content, keyNode, valueNode)
+		}
+	}
+
+	return delta
+}
+
+// nodesEqual reports whether two nodes hold the same data, ignoring comments,
+// styles and positions.
+func nodesEqual(a, b *yaml.Node) bool {
+	if a.Kind != b.Kind || a.ShortTag() != b.ShortTag() || a.Value != b.Value {
+		return false
+	}
+	if len(a.Content) != len(b.Content) {
+		return false
+	}
+	for i := range a.Content {
+		if !nodesEqual(a.Content[i], b.Content[i]) {
+			return false
+		}
+	}
+	return true
+}
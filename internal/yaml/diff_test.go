@@ -0,0 +1,61 @@
+package yaml
+
+import "testing"
+
+func TestExtractChanges(t *testing.T) {
+	content, person := readTestPerson(t)
+	older := person
+	older.Age = 31
+	moved := person
+	moved.Details.City = "Metropolis"
+
+	type app struct {
+		Age int `yaml:"age"`
+	}
+
+	tests := []struct {
+		name    string
+		content []byte
+		data    interface{}
+		opts    []Option
+		want    string
+	}{
+		{
+			name:    "changed age only",
+			content: content,
+			data:    older,
+			want:    "age: 31\n",
+		},
+		{
+			name:    "nested change keeps its parents",
+			content: content,
+			data:    moved,
+			want:    "details:\n  city: \"Metropolis\"\n",
+		},
+		{
+			name:    "nothing changed",
+			content: content,
+			data:    person,
+			want:    "{}\n",
+		},
+		{
+			name:    "options apply to the parse",
+			content: []byte("\xef\xbb\xbfimage: {{ .Values.image }}\nage: 30\n"),
+			data:    app{Age: 31},
+			opts:    []Option{WithPreserveTemplates()},
+			want:    "\xef\xbb\xbfage: 31\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := ExtractChanges(tt.content, tt.data, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", out, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,363 @@
+package yaml
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Document is a parsed YAML document that can be edited several times while
+// keeping its formatting, without re-parsing between edits. Paths use dotted
+// keys and [i] for sequence indices, e.g. "skills.programming[0].level"; the
+// empty path addresses the root. A key containing a dot is escaped as
+// files.application\.properties or quoted as files["application.properties"].
+type Document struct {
+	doc  *parsedDocument
+	opts Options
+}
+
+// Parse parses content into a Document. It is read and written back the
+// same way UpdateYAML does, so a byte order mark, blank lines between
+// sequence items and the indentation of sequences are kept; opts apply to
+// parsing, encoding and the values written by Set.
+func Parse(content []byte, opts ...Option) (*Document, error) {
+	options := newOptions(opts)
+	doc, err := parseDocument(content, options)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.root.Content) == 0 {
+		doc.root.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+	return &Document{doc: doc, opts: options}, nil
+}
+
+// Get decodes the value at path.
+func (d *Document) Get(path string) (interface{}, error) {
+	node, err := d.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return value, nil
+}
+
+// Set writes value at path, creating missing intermediate collections: a
+// sequence where an index follows, a mapping otherwise. A sequence index may
+// address an existing element or the position right after the last one. If
+// Set fails, the document is left as it was.
+func (d *Document) Set(path string, value interface{}) error {
+	segments, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+
+	// Walk the part of the path the document already has
+	node := d.body()
+	depth := 0
+	for ; depth < len(segments); depth++ {
+		child, ok := childNode(node, segments[depth])
+		if !ok {
+			break
+		}
+		node = child
+	}
+
+	u := newUpdater(d.opts)
+	if depth == len(segments) {
+		// Update a copy so that a failure halfway leaves the node untouched
+		updated := cloneNode(node)
+		if err := u.updateNode(updated, reflect.ValueOf(&value).Elem()); err != nil {
+			return fmt.Errorf("failed to set %s: %w", path, err)
+		}
+		*node = *updated
+		return nil
+	}
+
+	// The rest of the path is built detached and attached once value is written
+	parent, segment := node, segments[depth]
+	if err := checkChild(parent, segment); err != nil {
+		return fmt.Errorf("failed to set %s: %w", formatPath(segments[:depth+1]), err)
+	}
+	top := &yaml.Node{}
+	leaf := top
+	for i := depth + 1; i < len(segments); i++ {
+		if segments[i].isIndex && segments[i].index != 0 {
+			return fmt.Errorf("failed to set %s: %w", formatPath(segments[:i+1]),
+				fmt.Errorf("index %d out of range", segments[i].index))
+		}
+		leaf = newChild(leaf, segments[i])
+	}
+	if err := u.updateNode(leaf, reflect.ValueOf(&value).Elem()); err != nil {
+		return fmt.Errorf("failed to set %s: %w", path, err)
+	}
+	addChild(parent, segment, top)
+	return nil
+}
+
+// Delete removes the value at path along with its key or sequence slot.
+func (d *Document) Delete(path string) error {
+	segments, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 {
+		return fmt.Errorf("cannot delete the document root")
+	}
+
+	parent, err := lookupPath(d.body(), segments[:len(segments)-1])
+	if err != nil {
+		return err
+	}
+	last := segments[len(segments)-1]
+	if !removeChild(parent, last) {
+		return fmt.Errorf("%w: %s", ErrPathNotFound, path)
+	}
+	if last.isIndex && last.index == 0 && len(parent.Content) > 0 && d.doc.blankLines != nil {
+		d.doc.blankLines.unmark(parent.Content[0])
+	}
+	return nil
+}
+
+// Keys returns the keys of the mapping at path in document order.
+func (d *Document) Keys(path string) ([]string, error) {
+	node, err := d.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s is not a mapping", path)
+	}
+
+	keys := make([]string, 0, len(node.Content)/2)
+	for i := 0; i < len(node.Content); i += 2 {
+		keys = append(keys, keyValue(node.Content[i]))
+	}
+	return keys, nil
+}
+
+// Bytes encodes the document the way UpdateYAML writes its output.
+func (d *Document) Bytes() ([]byte, error) {
+	return d.doc.encode(d.opts)
+}
+
+// SetValueAtPath writes value at path in content, like Document.Set, and
+// returns the updated content.
+func SetValueAtPath(content []byte, path string, value interface{}) ([]byte, error) {
+	doc, err := Parse(content)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.Set(path, value); err != nil {
+		return nil, err
+	}
+	return doc.Bytes()
+}
+
+// DeleteValueAtPath removes the value at path in content, like Document.Delete,
+// and returns the updated content.
+func DeleteValueAtPath(content []byte, path string) ([]byte, error) {
+	out, _, err := DeleteValueAtPathWithRange(content, path)
+	return out, err
+}
+
+// DeleteValueAtPathWithRange behaves like DeleteValueAtPath and also returns
+// the 1-based, inclusive range of lines of content that held the deleted key
+// and its value, blocks and multi-line scalars included. Comments and blank
+// lines after the value are not part of the range.
+func DeleteValueAtPathWithRange(content []byte, path string) ([]byte, [2]int, error) {
+	doc, err := Parse(content)
+	if err != nil {
+		return nil, [2]int{}, err
+	}
+	segments, err := parsePath(path)
+	if err != nil {
+		return nil, [2]int{}, err
+	}
+	if len(segments) == 0 {
+		return nil, [2]int{}, fmt.Errorf("cannot delete the document root")
+	}
+
+	parent, err := lookupPath(doc.body(), segments[:len(segments)-1])
+	if err != nil {
+		return nil, [2]int{}, err
+	}
+	start, column, value := entryPosition(parent, segments[len(segments)-1])
+	if value == nil {
+		return nil, [2]int{}, fmt.Errorf("%w: %s", ErrPathNotFound, path)
+	}
+	lines := bytes.Split(doc.doc.content, []byte("\n"))
+	span := [2]int{start, valueEnd(lines, start, column, value)}
+
+	if err := doc.Delete(path); err != nil {
+		return nil, [2]int{}, err
+	}
+	out, err := doc.Bytes()
+	if err != nil {
+		return nil, [2]int{}, err
+	}
+	return out, span, nil
+}
+
+// entryPosition returns the line and 0-based column where the entry addressed
+// by segment starts in node, i.e. its key or the dash of a sequence item,
+// along with the entry's value. The value is nil if there is no such entry.
+func entryPosition(node *yaml.Node, segment pathSegment) (line, column int, value *yaml.Node) {
+	if node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	if segment.isIndex {
+		if node.Kind != yaml.SequenceNode || segment.index >= len(node.Content) {
+			return 0, 0, nil
+		}
+		item := node.Content[segment.index]
+		return item.Line, node.Column - 1, item
+	}
+	if node.Kind != yaml.MappingNode {
+		return 0, 0, nil
+	}
+	keyNode, valueNode, found := findNodes(node, segment.key)
+	if !found {
+		return 0, 0, nil
+	}
+	return keyNode.Line, keyNode.Column - 1, valueNode
+}
+
+// valueEnd returns the last line of the entry starting at line start, column
+// column: the last following line indented deeper, or holding a dash at the
+// entry's column if value is a block sequence, before the next entry. Lines
+// of a literal or folded block starting with # are text, not comments.
+func valueEnd(lines [][]byte, start, column int, value *yaml.Node) int {
+	seqValue := value.Kind == yaml.SequenceNode && value.Style&yaml.FlowStyle == 0
+	blockScalar := value.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0
+	end := start
+	for i := start; i < len(lines); i++ {
+		trimmed := bytes.TrimLeft(lines[i], " ")
+		if len(bytes.TrimSpace(trimmed)) == 0 {
+			continue
+		}
+		indent := len(lines[i]) - len(trimmed)
+		switch {
+		case indent > column, seqValue && indent == column && isDashLine(trimmed):
+			if trimmed[0] != '#' || blockScalar {
+				end = i + 1
+			}
+		case trimmed[0] == '#':
+			// A comment may sit above the next entry at any column
+		default:
+			return end
+		}
+	}
+	return end
+}
+
+func (d *Document) body() *yaml.Node {
+	return d.doc.root.Content[0]
+}
+
+func (d *Document) lookup(path string) (*yaml.Node, error) {
+	segments, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	return lookupPath(d.body(), segments)
+}
+
+// checkChild reports why an entry for segment cannot be added to node. An
+// empty or null node can become the collection segment needs.
+func checkChild(node *yaml.Node, segment pathSegment) error {
+	empty := node.Kind == 0 || (node.Kind == yaml.ScalarNode && node.Tag == "!!null")
+	if segment.isIndex {
+		if empty {
+			node = &yaml.Node{Kind: yaml.SequenceNode}
+		}
+		if node.Kind != yaml.SequenceNode {
+			return fmt.Errorf("not a sequence")
+		}
+		if segment.index != len(node.Content) {
+			return fmt.Errorf("index %d out of range", segment.index)
+		}
+		return nil
+	}
+	if !empty && node.Kind != yaml.MappingNode {
+		return fmt.Errorf("not a mapping")
+	}
+	return nil
+}
+
+// newChild adds an empty entry for segment to the empty node, turning it into
+// the collection segment needs, and returns the entry's value.
+func newChild(node *yaml.Node, segment pathSegment) *yaml.Node {
+	child := &yaml.Node{}
+	addChild(node, segment, child)
+	return child
+}
+
+// addChild adds child as the entry for segment to node, which checkChild
+// accepted, turning an empty node into the required collection.
+func addChild(node *yaml.Node, segment pathSegment, child *yaml.Node) {
+	if segment.isIndex {
+		if node.Kind != yaml.SequenceNode {
+			setCollectionKind(node, yaml.SequenceNode, "!!seq")
+		}
+		node.Content = append(node.Content, child)
+		return
+	}
+
+	if node.Kind != yaml.MappingNode {
+		setCollectionKind(node, yaml.MappingNode, "!!map")
+	}
+	keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: segment.key}
+	node.Content = append(node.Content, keyNode, child)
+}
+
+// removeChild removes the entry addressed by segment from node.
+func removeChild(node *yaml.Node, segment pathSegment) bool {
+	if segment.isIndex {
+		if node.Kind != yaml.SequenceNode || segment.index >= len(node.Content) {
+			return false
+		}
+		node.Content = append(node.Content[:segment.index], node.Content[segment.index+1:]...)
+		return true
+	}
+
+	if node.Kind != yaml.MappingNode {
+		return false
+	}
+	for i := 0; i < len(node.Content); i += 2 {
+		if keyValue(node.Content[i]) == segment.key {
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// cloneNode returns a deep copy of node that keeps its anchors. Aliases to
+// anchors inside node point at their copies, others at the original anchors.
+func cloneNode(node *yaml.Node) *yaml.Node {
+	copies := map[*yaml.Node]*yaml.Node{}
+	var clone func(n *yaml.Node) *yaml.Node
+	clone = func(n *yaml.Node) *yaml.Node {
+		dup := *n
+		copies[n] = &dup
+		dup.Content = make([]*yaml.Node, len(n.Content))
+		for i, child := range n.Content {
+			dup.Content[i] = clone(child)
+		}
+		return &dup
+	}
+	root := clone(node)
+	for _, dup := range copies {
+		if target, ok := copies[dup.Alias]; ok && dup.Alias != nil {
+			dup.Alias = target
+		}
+	}
+	return root
+}
@@ -0,0 +1,255 @@
+package yaml
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDocumentKeepsFormatting(t *testing.T) {
+	content := "\ufeffname: a\nlist:\n- x\n\n- y\n"
+
+	doc, err := Parse([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.Set("name", "b"); err != nil {
+		t.Fatal(err)
+	}
+	out, err := doc.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := UpdateYAML([]byte(content), map[string]interface{}{"name": "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != string(want) {
+		t.Errorf("Document output differs from UpdateYAML:\ngot:  %q\nwant: %q", out, want)
+	}
+	if wantText := "\ufeffname: b\nlist:\n- x\n\n- y\n"; string(out) != wantText {
+		t.Errorf("got %q, want %q", out, wantText)
+	}
+}
+
+func TestDocumentSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		path    string
+		value   interface{}
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "existing key",
+			content: "a: 1 # note\nb: 2\n",
+			path:    "a",
+			value:   5,
+			want:    "a: 5 # note\nb: 2\n",
+		},
+		{
+			name:    "missing nested keys",
+			content: "a: 1\n",
+			path:    "b.c",
+			value:   "x",
+			want:    "a: 1\nb:\n  c: x\n",
+		},
+		{
+			name:    "missing key followed by an index",
+			content: "a: 1\n",
+			path:    "e[0]",
+			value:   "x",
+			want:    "a: 1\ne:\n  - x\n",
+		},
+		{
+			name:    "append to a sequence",
+			content: "e:\n  - x\n",
+			path:    "e[1]",
+			value:   "y",
+			want:    "e:\n  - x\n  - y\n",
+		},
+		{
+			name:    "null becomes a mapping",
+			content: "a: null\n",
+			path:    "a.b",
+			value:   1,
+			want:    "a:\n  b: 1\n",
+		},
+		{
+			name:    "index into a scalar",
+			content: "a: 1\n",
+			path:    "a[0]",
+			value:   "x",
+			wantErr: true,
+		},
+		{
+			name:    "index past the end of a new sequence",
+			content: "a: 1\n",
+			path:    "e[1]",
+			value:   "x",
+			wantErr: true,
+		},
+		{
+			name:    "unsupported value under a missing key",
+			content: "a: 1\n",
+			path:    "e.f",
+			value:   make(chan int),
+			wantErr: true,
+		},
+		{
+			name:    "unsupported value inside an existing mapping",
+			content: "m:\n  a: 1\n",
+			path:    "m",
+			value:   map[string]interface{}{"a": 2, "b": func() {}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse([]byte(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = doc.Set(tt.path, tt.value)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("Set() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			out, err := doc.Bytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want
+			if tt.wantErr {
+				// A failed Set leaves the document as it was
+				want = tt.content
+			}
+			if string(out) != want {
+				t.Errorf("got:\n%s\nwant:\n%s", out, want)
+			}
+		})
+	}
+}
+
+func TestDeleteValueAtPathWithRange(t *testing.T) {
+	content := "\ufeffa: 1 # keep\nlist:\n- x\n\n- y\n- |\n  # text\n  more\nb:\n  c: 2\n  d: 3\nz: 9\n"
+
+	tests := []struct {
+		path      string
+		want      string
+		wantRange [2]int
+	}{
+		{
+			path:      "b",
+			want:      "\ufeffa: 1 # keep\nlist:\n- x\n\n- y\n- |\n  # text\n  more\nz: 9\n",
+			wantRange: [2]int{9, 11},
+		},
+		{
+			path:      "b.c",
+			want:      "\ufeffa: 1 # keep\nlist:\n- x\n\n- y\n- |\n  # text\n  more\nb:\n  d: 3\nz: 9\n",
+			wantRange: [2]int{10, 10},
+		},
+		{
+			path:      "list[2]",
+			want:      "\ufeffa: 1 # keep\nlist:\n- x\n\n- y\nb:\n  c: 2\n  d: 3\nz: 9\n",
+			wantRange: [2]int{6, 8},
+		},
+		{
+			path:      "list[0]",
+			want:      "\ufeffa: 1 # keep\nlist:\n- y\n- |\n  # text\n  more\nb:\n  c: 2\n  d: 3\nz: 9\n",
+			wantRange: [2]int{3, 3},
+		},
+		{
+			path:      "a",
+			want:      "\ufefflist:\n- x\n\n- y\n- |\n  # text\n  more\nb:\n  c: 2\n  d: 3\nz: 9\n",
+			wantRange: [2]int{1, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			out, span, err := DeleteValueAtPathWithRange([]byte(content), tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+			if span != tt.wantRange {
+				t.Errorf("range = %v, want %v", span, tt.wantRange)
+			}
+
+			plain, err := DeleteValueAtPath([]byte(content), tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(plain) != string(out) {
+				t.Errorf("DeleteValueAtPath differs:\n%q", plain)
+			}
+		})
+	}
+
+	if _, err := DeleteValueAtPath([]byte(content), "missing"); !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("deleting a missing key: got %v, want ErrPathNotFound", err)
+	}
+}
+
+func TestPathsWithDottedKeys(t *testing.T) {
+	content := "# config\nfiles:\n  application.properties: old # keep\n  other: 1\nserver.port: 80\n"
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{
+			name: "escaped dot",
+			path: `files.application\.properties`,
+			want: "# config\nfiles:\n  application.properties: v # keep\n  other: 1\nserver.port: 80\n",
+		},
+		{
+			name: "quoted key in brackets",
+			path: `files["application.properties"]`,
+			want: "# config\nfiles:\n  application.properties: v # keep\n  other: 1\nserver.port: 80\n",
+		},
+		{
+			name: "dotted key at the root",
+			path: `["server.port"]`,
+			want: "# config\nfiles:\n  application.properties: old # keep\n  other: 1\nserver.port: v\n",
+		},
+		{
+			name: "new dotted key",
+			path: `files.new\.key`,
+			want: "# config\nfiles:\n  application.properties: old # keep\n  other: 1\n  new.key: v\nserver.port: 80\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := SetValueAtPath([]byte(content), tt.path, "v")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+
+	doc, err := Parse([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := doc.Get(`files["application.properties"]`); err != nil || got != "old" {
+		t.Errorf("Get = %v, %v, want old", got, err)
+	}
+
+	out, err := DeleteValueAtPath([]byte(content), `server\.port`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "# config\nfiles:\n  application.properties: old # keep\n  other: 1\n"; string(out) != want {
+		t.Errorf("delete got:\n%q\nwant:\n%q", out, want)
+	}
+}
@@ -0,0 +1,31 @@
+package yaml
+
+import "errors"
+
+// ErrSequenceTooLong is returned when a sequence being written exceeds Options.MaxSequenceLen.
+var ErrSequenceTooLong = errors.New("sequence exceeds the maximum length")
+
+// ErrPathNotFound is returned when a path does not address any node in the document.
+var ErrPathNotFound = errors.New("path not found")
+
+// ErrUnsupportedType is returned for values that have no YAML representation, such as channels and funcs.
+var ErrUnsupportedType = errors.New("unsupported type")
+
+// ErrMergeKey is returned for struct fields mapped to the << merge key, whose
+// merge semantics cannot be expressed by setting a plain value.
+var ErrMergeKey = errors.New("merge key cannot be set from a struct field")
+
+// ErrVerificationFailed is returned when Options.VerifyOutput is set and the output does not round-trip.
+var ErrVerificationFailed = errors.New("output verification failed")
+
+// ErrTooManyChanges is returned when an update changes more values than Options.MaxChanges allows.
+var ErrTooManyChanges = errors.New("update changes too many values")
+
+// ErrExtraDocuments is returned under Options.Strict when the content holds documents after the first one.
+var ErrExtraDocuments = errors.New("content holds more than one document")
+
+// ErrUnknownSubstitution is returned under Options.FailOnUnknownSubstitution for a ${name} token with no substitution.
+var ErrUnknownSubstitution = errors.New("unknown substitution")
+
+// ErrTabIndentation is returned when content cannot be parsed because it is indented with tabs.
+var ErrTabIndentation = errors.New("tab indentation")
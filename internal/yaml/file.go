@@ -0,0 +1,82 @@
+package yaml
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// UpdateYAMLFile updates the YAML file at path in place with newData.
+// The new content is written to a temporary file in the same directory and
+// renamed over the original, so a crash mid-write never leaves a truncated file.
+// A symlink at path is followed and its target is replaced. The original file
+// mode is kept and, on Unix, so is its ownership when the process is
+// privileged enough to chown; otherwise the file ends up owned by the current
+// user. Any update options apply, see WithBackup for file-specific ones.
+func UpdateYAMLFile(path string, newData interface{}, opts ...Option) error {
+	options := newOptions(opts)
+
+	// Write through symlinks instead of replacing the link with a regular file
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	updated, err := UpdateYAMLWithOptions(content, newData, options)
+	if err != nil {
+		return err
+	}
+
+	if options.BackupSuffix != "" {
+		if err := os.WriteFile(path+options.BackupSuffix, content, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("failed to write backup: %w", err)
+		}
+	}
+
+	return writeFileAtomic(path, updated, info)
+}
+
+// writeFileAtomic replaces path with data, giving the new file the mode and,
+// where possible, the ownership described by info.
+func writeFileAtomic(path string, data []byte, info os.FileInfo) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err = tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync temp file: %w", err)
+	}
+	if err = tmp.Chmod(info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to set file mode: %w", err)
+	}
+	if err = preserveOwner(tmp, info); err != nil {
+		return fmt.Errorf("failed to set file owner: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package yaml
+
+import "os"
+
+// preserveOwner is a no-op on platforms without Unix ownership.
+func preserveOwner(f *os.File, info os.FileInfo) error {
+	return nil
+}
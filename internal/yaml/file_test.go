@@ -0,0 +1,189 @@
+package yaml
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateYAMLFilePreservesMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("name: a # keep\nage: 1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	data := map[string]interface{}{"name": "b", "age": 1}
+	if err := UpdateYAMLFile(path, data); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "name: b # keep\nage: 1\n"; string(got) != want {
+		t.Errorf("content = %q, want %q", got, want)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Errorf("mode = %o, want 600", mode)
+	}
+}
+
+func TestUpdateYAMLFileErrors(t *testing.T) {
+	t.Run("missing file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "missing.yaml")
+		err := UpdateYAMLFile(path, map[string]interface{}{"name": "b"})
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("got error %v, want os.ErrNotExist", err)
+		}
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s was created", path)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		content string
+		data    interface{}
+	}{
+		{
+			name:    "invalid YAML",
+			content: "name: [a\n",
+			data:    map[string]interface{}{"name": "b"},
+		},
+		{
+			name:    "unsupported data",
+			content: "name: a\n",
+			data:    42,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := UpdateYAMLFile(path, tt.data, WithBackup(".bak")); err == nil {
+				t.Fatal("expected an error")
+			}
+
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.content {
+				t.Errorf("content = %q, want it unchanged", got)
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("directory holds %d entries, want only config.yaml", len(entries))
+			}
+		})
+	}
+}
+
+func TestUpdateYAMLFileWithBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	original := "name: a\n"
+	if err := os.WriteFile(path, []byte(original), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := UpdateYAMLFile(path, map[string]interface{}{"name": "b"}, WithBackup(".bak")); err != nil {
+		t.Fatal(err)
+	}
+
+	backup, err := os.ReadFile(path + ".bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(backup) != original {
+		t.Errorf("backup = %q, want %q", backup, original)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "name: b\n"; string(got) != want {
+		t.Errorf("content = %q, want %q", got, want)
+	}
+}
+
+func TestUpdateYAMLFileWritesSymlinkTarget(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "real.yaml")
+	link := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(target, []byte("name: a\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	if err := UpdateYAMLFile(link, map[string]interface{}{"name": "b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("%s was replaced by a regular file", link)
+	}
+	got, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "name: b\n"; string(got) != want {
+		t.Errorf("target content = %q, want %q", got, want)
+	}
+	info, err = os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Errorf("target mode = %o, want 600", mode)
+	}
+}
+
+func TestWriteFileAtomicRemovesTempFileOnError(t *testing.T) {
+	dir := t.TempDir()
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Renaming a file over a non-empty directory fails after the temp file is written
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.MkdirAll(filepath.Join(path, "child"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomic(path, []byte("name: b\n"), info); err == nil {
+		t.Fatal("expected an error replacing a directory")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "config.yaml" {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("directory holds %v, want only config.yaml", names)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build unix
+
+package yaml
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// preserveOwner gives f the uid/gid recorded in info. Changing ownership
+// requires privileges, so a permission error is ignored and the file keeps the
+// owner of the current process.
+func preserveOwner(f *os.File, info os.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	if err := f.Chown(int(stat.Uid), int(stat.Gid)); err != nil && !errors.Is(err, os.ErrPermission) {
+		return err
+	}
+	return nil
+}
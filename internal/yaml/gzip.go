@@ -0,0 +1,50 @@
+package yaml
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// gzipMagic is the header every gzip stream starts with.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// UpdateYAMLGzip updates gzip-compressed YAML: content is decompressed, updated
+// with data and compressed again. Content without the gzip magic bytes is
+// treated as plain YAML and returned uncompressed, exactly like UpdateYAML.
+// opts tune the update as for UpdateYAML.
+func UpdateYAMLGzip(content []byte, data interface{}, opts ...Option) ([]byte, error) {
+	if !bytes.HasPrefix(content, gzipMagic) {
+		return UpdateYAML(content, data, opts...)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open gzip stream: %w", err)
+	}
+	plain, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress: %w", err)
+	}
+	if err := zr.Close(); err != nil {
+		return nil, fmt.Errorf("failed to decompress: %w", err)
+	}
+
+	updated, err := UpdateYAML(plain, data, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	// Keep the original file name and timestamp in the new header
+	zw.Header = zr.Header
+	if _, err := zw.Write(updated); err != nil {
+		return nil, fmt.Errorf("failed to compress: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,87 @@
+package yaml
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestUpdateYAMLGzip(t *testing.T) {
+	compress := func(t *testing.T, content string) []byte {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Name = "config.yaml"
+		zw.ModTime = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		if _, err := zw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	data := map[string]interface{}{"b": map[string]interface{}{"c": 3}}
+
+	tests := []struct {
+		name    string
+		content string
+		gzipped bool
+		opts    []Option
+		want    string
+	}{
+		{
+			name:    "gzipped input",
+			content: "a: 1 # keep\nb:\n  c: 2\n",
+			gzipped: true,
+			want:    "a: 1 # keep\nb:\n  c: 3\n",
+		},
+		{
+			name:    "plain input",
+			content: "a: 1 # keep\nb:\n  c: 2\n",
+			want:    "a: 1 # keep\nb:\n  c: 3\n",
+		},
+		{
+			name:    "options",
+			content: "a: 1\n",
+			gzipped: true,
+			opts:    []Option{WithIndent(4)},
+			want:    "a: 1\nb:\n    c: 3\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := []byte(tt.content)
+			if tt.gzipped {
+				content = compress(t, tt.content)
+			}
+			out, err := UpdateYAMLGzip(content, data, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.gzipped {
+				if string(out) != tt.want {
+					t.Errorf("got:\n%s\nwant:\n%s", out, tt.want)
+				}
+				return
+			}
+
+			zr, err := gzip.NewReader(bytes.NewReader(out))
+			if err != nil {
+				t.Fatalf("output is not gzipped: %v", err)
+			}
+			plain, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(plain) != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", plain, tt.want)
+			}
+			if zr.Name != "config.yaml" || !zr.ModTime.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+				t.Errorf("header not kept: name %q, time %v", zr.Name, zr.ModTime)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package yaml
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// UpdateAndMarshalJSON updates content with data like UpdateYAML and also
+// returns the JSON serialization of the resulting document. YAML-only types are
+// mapped to JSON strings: timestamps as RFC 3339, !!binary as its base64 text
+// and .inf/.nan floats as written in the YAML. opts tune the update as for
+// UpdateYAML; template actions kept by PreserveTemplates appear verbatim.
+func UpdateAndMarshalJSON(content []byte, data interface{}, opts ...Option) (yamlOut []byte, jsonOut []byte, err error) {
+	options := newOptions(opts)
+	yamlOut, err = UpdateYAMLWithOptions(content, data, options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	doc, err := parseDocument(yamlOut, options)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse updated YAML: %w", err)
+	}
+	root := doc.root
+	if doc.templates != nil {
+		doc.templates.unmaskNode(&root)
+	}
+
+	value, err := jsonValue(&root)
+	if err != nil {
+		return nil, nil, err
+	}
+	jsonOut, err = json.Marshal(value)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	return yamlOut, jsonOut, nil
+}
+
+// jsonValue converts node into a value encoding/json can serialize.
+func jsonValue(node *yaml.Node) (interface{}, error) {
+	switch node.Kind {
+	case 0:
+		return nil, nil
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return jsonValue(node.Content[0])
+	case yaml.AliasNode:
+		return jsonValue(node.Alias)
+	case yaml.SequenceNode:
+		values := make([]interface{}, 0, len(node.Content))
+		for _, child := range node.Content {
+			value, err := jsonValue(child)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	case yaml.MappingNode:
+		values := make(map[string]interface{}, len(node.Content)/2)
+		if err := mergeJSONMapping(values, node); err != nil {
+			return nil, err
+		}
+		return values, nil
+	}
+
+	switch node.ShortTag() {
+	case "!!binary":
+		return node.Value, nil
+	case "!!timestamp":
+		var t time.Time
+		if err := node.Decode(&t); err != nil {
+			return nil, fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		return t.Format(time.RFC3339Nano), nil
+	}
+
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return nil, fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	if f, ok := value.(float64); ok && (math.IsInf(f, 0) || math.IsNaN(f)) {
+		return node.Value, nil
+	}
+	return value, nil
+}
+
+// mergeJSONMapping adds the pairs of node to values. Entries pulled in with the
+// << merge key never override keys the mapping defines itself.
+func mergeJSONMapping(values map[string]interface{}, node *yaml.Node) error {
+	var merges []*yaml.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, valueNode := node.Content[i], node.Content[i+1]
+		if key.ShortTag() == "!!merge" {
+			merges = append(merges, valueNode)
+			continue
+		}
+		value, err := jsonValue(valueNode)
+		if err != nil {
+			return err
+		}
+		values[keyValue(key)] = value
+	}
+
+	for _, merge := range merges {
+		if merge.Kind == yaml.AliasNode {
+			merge = merge.Alias
+		}
+		sources := []*yaml.Node{merge}
+		if merge.Kind == yaml.SequenceNode {
+			sources = merge.Content
+		}
+		for _, source := range sources {
+			if source.Kind == yaml.AliasNode {
+				source = source.Alias
+			}
+			inherited := map[string]interface{}{}
+			if err := mergeJSONMapping(inherited, source); err != nil {
+				return err
+			}
+			for key, value := range inherited {
+				if _, ok := values[key]; !ok {
+					values[key] = value
+				}
+			}
+		}
+	}
+	return nil
+}
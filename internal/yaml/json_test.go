@@ -0,0 +1,76 @@
+package yaml
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUpdateAndMarshalJSON(t *testing.T) {
+	content, person := readTestPerson(t)
+	older := person
+	older.Age = 31
+
+	type release struct {
+		Built time.Time `yaml:"built"`
+		Ratio float64   `yaml:"ratio"`
+	}
+
+	tests := []struct {
+		name     string
+		content  []byte
+		data     interface{}
+		opts     []Option
+		wantJSON string
+	}{
+		{
+			name:     "timestamps and special floats",
+			content:  []byte("built: 2020-01-01T00:00:00Z\nratio: 1\nblob: !!binary aGVsbG8=\n"),
+			data:     release{Built: time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC), Ratio: math.Inf(-1)},
+			wantJSON: `{"blob":"aGVsbG8=","built":"2024-05-06T07:08:09Z","ratio":"-.inf"}`,
+		},
+		{
+			name:     "template actions",
+			content:  []byte("image: {{ .Values.image }}\nratio: 1\n"),
+			data:     map[string]interface{}{"ratio": 2},
+			opts:     []Option{WithPreserveTemplates()},
+			wantJSON: `{"image":"{{ .Values.image }}","ratio":2}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, jsonOut, err := UpdateAndMarshalJSON(tt.content, tt.data, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(jsonOut) != tt.wantJSON {
+				t.Errorf("got %s, want %s", jsonOut, tt.wantJSON)
+			}
+		})
+	}
+
+	t.Run("outputs agree", func(t *testing.T) {
+		yamlOut, jsonOut, err := UpdateAndMarshalJSON(content, older)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := UpdateYAML(content, older)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(yamlOut) != string(want) {
+			t.Errorf("YAML differs from UpdateYAML:\n%s", yamlOut)
+		}
+
+		var fromJSON testPerson
+		if err := json.Unmarshal(jsonOut, &fromJSON); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(fromJSON, older) {
+			t.Errorf("JSON decodes to %+v, want %+v", fromJSON, older)
+		}
+	})
+}
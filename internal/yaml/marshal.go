@@ -0,0 +1,39 @@
+package yaml
+
+import (
+	"bytes"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MarshalDocuments builds a new YAML document for each element of datas and
+// returns them as one multi-document stream separated by `---`. Keys follow
+// the same rules as documents created from scratch by UpdateYAML and are
+// indented by 2 unless WithIndent is given. Map entries are written in
+// sorted key order, so the same datas always produce the same bytes.
+func MarshalDocuments(datas []interface{}, opts ...Option) ([]byte, error) {
+	options := newOptions(opts)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(options.indentation(nil))
+
+	for i, data := range datas {
+		doc := &yaml.Node{
+			Kind:    yaml.DocumentNode,
+			Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}},
+		}
+		if err := newUpdater(options).updateYamlFromStruct(doc, data); err != nil {
+			return nil, fmt.Errorf("failed to build document %d: %w", i, err)
+		}
+		if err := enc.Encode(doc); err != nil {
+			return nil, fmt.Errorf("failed to encode document %d: %w", i, err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode YAML: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
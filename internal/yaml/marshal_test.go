@@ -0,0 +1,25 @@
+package yaml
+
+import "testing"
+
+func TestMarshalDocuments(t *testing.T) {
+	type service struct {
+		Name string `yaml:"name"`
+		Port int    `yaml:"port"`
+	}
+	datas := []interface{}{
+		service{Name: "web", Port: 80},
+		map[string]interface{}{"kind": "Config", "data": map[string]string{"b": "2", "a": "1"}},
+	}
+
+	want := "name: web\nport: 80\n---\ndata:\n  a: \"1\"\n  b: \"2\"\nkind: Config\n"
+	for i := 0; i < 20; i++ {
+		out, err := MarshalDocuments(datas)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != want {
+			t.Fatalf("MarshalDocuments() =\n%s\nwant\n%s", out, want)
+		}
+	}
+}
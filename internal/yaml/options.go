@@ -0,0 +1,612 @@
+package yaml
+
+import (
+	"log/slog"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BoolStyle selects how boolean values are spelled when they are written.
+type BoolStyle int
+
+const (
+	// TrueFalse writes booleans as true/false, the YAML 1.2 spelling.
+	TrueFalse BoolStyle = iota
+	// YesNo writes booleans as yes/no for legacy YAML 1.1 consumers.
+	YesNo
+	// OnOff writes booleans as on/off for legacy YAML 1.1 consumers.
+	OnOff
+)
+
+func (s BoolStyle) format(b bool) string {
+	switch {
+	case s == YesNo && b:
+		return "yes"
+	case s == YesNo:
+		return "no"
+	case s == OnOff && b:
+		return "on"
+	case s == OnOff:
+		return "off"
+	case b:
+		return "true"
+	default:
+		return "false"
+	}
+}
+
+// Schema identifies the YAML version the output has to be read back with.
+type Schema int
+
+const (
+	// Core12 targets YAML 1.2 core schema parsers such as yaml.v3.
+	Core12 Schema = iota
+	// Legacy11 targets YAML 1.1 parsers, where yes/no/on/off are booleans
+	// and 1:20 is a number. Strings spelled like those are quoted.
+	Legacy11
+)
+
+// ZeroValuePolicy decides how struct fields holding the zero value of their
+// type are written.
+type ZeroValuePolicy int
+
+const (
+	// ZeroWrite writes zero values like any other value, e.g. 0 for an int.
+	ZeroWrite ZeroValuePolicy = iota
+	// ZeroOmitIfAbsent writes a zero value only over a key the document
+	// already has and adds no key for it.
+	ZeroOmitIfAbsent
+	// ZeroNull writes zero values as null.
+	ZeroNull
+)
+
+// Options configures how UpdateYAMLWithOptions applies new data to a document.
+// The zero value matches the behavior of UpdateYAML.
+type Options struct {
+	// NormalizeScalars rewrites every scalar the updater touches into its
+	// canonical form: integers in plain decimal, booleans as true/false and
+	// strings quoted only when needed. When false, the original rendering of a
+	// scalar is kept as long as its value did not change, so for example a null
+	// spelled ~ stays ~ when it is written as nil again.
+	NormalizeScalars bool
+
+	// OnlyNonNilPointers skips struct fields holding a nil pointer, leaving the
+	// existing value in the document untouched. This gives PATCH-like semantics
+	// where pointer fields model "unset" versus "set".
+	OnlyNonNilPointers bool
+
+	// MaxSequenceLen, when positive, makes the update fail with
+	// ErrSequenceTooLong if any slice or array being written has more elements.
+	MaxSequenceLen int
+
+	// PreserveTemplates treats Go/Helm template actions ({{ ... }}) as opaque
+	// text: they are masked before parsing and restored verbatim on output, so
+	// untouched templated values are never corrupted. Actions must fit on one
+	// line; lines made only of actions (e.g. {{- if .x }}) are kept as-is too.
+	PreserveTemplates bool
+
+	// BoolStyle controls the spelling of written boolean values. Values that
+	// did not change keep their original spelling either way.
+	BoolStyle BoolStyle
+
+	// NormalizeTabs expands tabs in the indentation of the input to spaces
+	// before parsing, one indentation level per tab, so files accidentally
+	// indented with tabs can be read and are written back with spaces. Tabs
+	// leading the lines of block scalars are expanded as well.
+	NormalizeTabs bool
+
+	// IndentDetector, when set, replaces the built-in indentation heuristic.
+	// It receives the original content and returns the indent to encode with.
+	IndentDetector func(content []byte) int
+
+	// CoerceToExistingTag keeps the type an existing scalar has in the file
+	// when the new value can be represented in it, e.g. a Go string "5"
+	// written over `port: 5` stays an !!int, and a Go int written over
+	// `port: "5"` stays a string.
+	CoerceToExistingTag bool
+
+	// Schema selects the YAML version whose resolution rules written strings
+	// must survive. Booleans are written as true/false, which both versions
+	// understand, unless BoolStyle says otherwise.
+	Schema Schema
+
+	// BackupSuffix, when set, makes UpdateYAMLFile copy the original file to
+	// path+BackupSuffix before replacing it.
+	BackupSuffix string
+
+	// RootColumn indents the whole output by that many spaces, for documents
+	// that are embedded in another one. The default writes the root at column 0.
+	RootColumn int
+
+	// CompactFlowThreshold, when positive, writes sequences and mappings made
+	// only of scalars in flow style ([a, b], {a: 1}) if they have at most that
+	// many entries. Larger collections keep their style.
+	CompactFlowThreshold int
+
+	// ScalarFormatters override how scalars are rendered, keyed by the tag
+	// they are written with: "!!int", "!!float", "!!bool" or "!!str" (which
+	// also covers kinds without a tag of their own). The formatter returns
+	// the text to write and its style, e.g. 0 for plain.
+	ScalarFormatters map[string]func(reflect.Value) (value string, style yaml.Style)
+
+	// Logger receives debug-level traces of the traversal and the warnings
+	// of the update at warn level, except from UpdateYAMLResult, which
+	// returns them instead. Nothing is logged when it is nil.
+	Logger *slog.Logger
+
+	// ManagedRegion holds begin and end comment markers, e.g. "BEGIN managed"
+	// and "END managed". When set, only keys on lines between a begin and an
+	// end marker comment are updated; keys outside are kept as they are
+	// (though keys nested in them may be inside a region and are updated),
+	// and missing keys are not added since they would land outside.
+	ManagedRegion [2]string
+
+	// PruneUnknownKeys removes the keys of mappings written from a struct
+	// that no field of the struct maps to, so the document matches the
+	// struct exactly. Keys of an inline map count as known, merge keys are
+	// kept.
+	PruneUnknownKeys bool
+
+	// FlowStylePaths and BlockStylePaths force the collections at the given
+	// paths, e.g. "resources.limits", to flow or block style regardless of
+	// their size and original style. Paths missing from the document are
+	// ignored.
+	FlowStylePaths  []string
+	BlockStylePaths []string
+
+	// DedupScalarSequences removes repeated values from the sequences written
+	// that hold only scalars, keeping the first occurrence of each, so lists
+	// of tags and the like stay set-like.
+	DedupScalarSequences bool
+
+	// CopyLineComments gives new keys the line comments of the mapping's
+	// last pair, whose position they copy, for files where every pair
+	// carries a similar note. Head comments are never copied, as they
+	// describe the pair they sit above.
+	CopyLineComments bool
+
+	// OnKey, if set, is called for every key/value pair of the updated
+	// document, parents before children, with the pair's path. It may
+	// modify the nodes, e.g. to rename keys.
+	OnKey func(path string, key, value *yaml.Node)
+
+	// FieldFilter, when set, is asked about every struct field before it is
+	// written, with the field's dotted path (e.g. "details.city"). Returning
+	// false skips the field and leaves the document untouched for its key.
+	FieldFilter func(path string, field reflect.StructField) bool
+
+	// VerifyOutput re-parses the final output, as the next update would read
+	// it, and fails with ErrVerificationFailed instead of returning it if it is
+	// not valid YAML (e.g. duplicate keys) or does not decode to the updated
+	// data.
+	VerifyOutput bool
+
+	// VerifyScalars checks that every number written decodes back to exactly
+	// the Go value it was written from and fails the update with
+	// ErrVerificationFailed otherwise, e.g. for values that cannot be spelled
+	// losslessly.
+	VerifyScalars bool
+
+	// SortKeys sorts the keys of every mapping in the document by name, for
+	// canonical output. Comments move along with their keys, except for the
+	// document's header above the first key.
+	SortKeys bool
+
+	// PinnedKeys are emitted first, in the given order, in every mapping
+	// that has them, ahead of the sorted remaining keys (e.g. apiVersion,
+	// kind, metadata). Setting PinnedKeys implies SortKeys.
+	PinnedKeys []string
+
+	// KeyMatcher, if set, decides whether an existing document key matches the
+	// key a field or map entry maps to when there is no exact match, e.g. to
+	// match UserName against user_name. Matched keys keep their spelling.
+	KeyMatcher func(a, b string) bool
+
+	// KeyAliases maps old key names to new ones for migrations. When the
+	// document has no key a field or map entry maps to but has an old name
+	// aliased to it, that key is renamed in place, keeping its value and
+	// comments.
+	KeyAliases map[string]string
+
+	// MaxChanges, if positive, caps how many scalar values one update may
+	// change or add. Updates over the cap fail with ErrTooManyChanges and
+	// produce no output.
+	MaxChanges int
+
+	// AppendChecksum ends the output with a "# sha256: <hash>" comment line
+	// holding the SHA-256 of everything before it; see VerifyChecksum. The
+	// checksum line of the content being updated is replaced.
+	AppendChecksum bool
+
+	// HeaderComment is written at the top of the output, e.g. "DO NOT EDIT -
+	// generated by X". It may span several lines; lines not starting with #
+	// are commented out. A header the document already has is kept below it
+	// unless ReplaceHeader is set.
+	HeaderComment string
+	ReplaceHeader bool
+
+	// Strict fails the update with ErrExtraDocuments instead of warning when
+	// content holds more documents than the first one, which is all that is
+	// updated and written back.
+	Strict bool
+
+	// Substitutions replaces ${name} tokens in the string values written with
+	// the value stored under name. Tokens without an entry are left as they
+	// are, unless FailOnUnknownSubstitution is set, which makes the update
+	// fail with ErrUnknownSubstitution.
+	Substitutions             map[string]string
+	FailOnUnknownSubstitution bool
+
+	// TagName is the struct tag that names keys and holds options such as
+	// omitempty, e.g. "json" for structs shared with an API. It defaults to
+	// "yaml"; fields without the tag use their Go name.
+	TagName string
+
+	// OnlyFillEmpty leaves scalars that already hold a value as they are and
+	// only writes empty and null ones, so values a person filled in survive.
+	OnlyFillEmpty bool
+
+	// ZeroValuePolicy selects how fields holding their zero value are
+	// written. The default, ZeroWrite, writes them as is. Fields tagged
+	// omitempty or default keep their own rules.
+	ZeroValuePolicy ZeroValuePolicy
+
+	// MapKeyOrder orders the entries Go maps add to the document by their
+	// keys' string form; keys already in the document keep their place.
+	// By default integer keys are ordered numerically and other keys
+	// lexically, so the output is the same on every run.
+	MapKeyOrder func(a, b string) bool
+}
+
+// tagName returns the struct tag key fields are read from.
+func (o Options) tagName() string {
+	if o.TagName != "" {
+		return o.TagName
+	}
+	return "yaml"
+}
+
+// indentation returns the indent to encode content with.
+func (o Options) indentation(content []byte) int {
+	if o.IndentDetector != nil {
+		return o.IndentDetector(content)
+	}
+	return detectIndentation(string(content))
+}
+
+// Option adjusts Options; see the With* helpers.
+type Option func(*Options)
+
+// WithOptions starts from options as a whole, e.g. a configuration shared
+// with UpdateYAMLWithOptions. Options after it adjust the result further.
+func WithOptions(options Options) Option {
+	return func(o *Options) {
+		*o = options
+	}
+}
+
+// WithIndent forces the number of spaces used per indentation level.
+func WithIndent(n int) Option {
+	return func(o *Options) {
+		o.IndentDetector = func([]byte) int { return n }
+	}
+}
+
+// WithBackup makes UpdateYAMLFile keep a copy of the original file at
+// path+suffix (e.g. ".bak") so a bad update can be rolled back.
+func WithBackup(suffix string) Option {
+	return func(o *Options) {
+		o.BackupSuffix = suffix
+	}
+}
+
+// WithPruneUnknownKeys removes keys no struct field maps to; see
+// Options.PruneUnknownKeys.
+func WithPruneUnknownKeys() Option {
+	return func(o *Options) {
+		o.PruneUnknownKeys = true
+	}
+}
+
+// WithLogger sends debug traces of the update to logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *Options) {
+		o.Logger = logger
+	}
+}
+
+// WithStrict fails the update with ErrExtraDocuments when content holds more
+// than one document; see Options.Strict.
+func WithStrict() Option {
+	return func(o *Options) {
+		o.Strict = true
+	}
+}
+
+// WithTagName reads key names and options from the given struct tag instead
+// of yaml; see Options.TagName.
+func WithTagName(name string) Option {
+	return func(o *Options) {
+		o.TagName = name
+	}
+}
+
+// WithMapKeyOrder orders new map entries with less; see Options.MapKeyOrder.
+func WithMapKeyOrder(less func(a, b string) bool) Option {
+	return func(o *Options) {
+		o.MapKeyOrder = less
+	}
+}
+
+// WithNormalizeScalars writes every scalar touched in canonical form; see
+// Options.NormalizeScalars.
+func WithNormalizeScalars() Option {
+	return func(o *Options) {
+		o.NormalizeScalars = true
+	}
+}
+
+// WithOnlyNonNilPointers skips struct fields holding a nil pointer; see
+// Options.OnlyNonNilPointers.
+func WithOnlyNonNilPointers() Option {
+	return func(o *Options) {
+		o.OnlyNonNilPointers = true
+	}
+}
+
+// WithMaxSequenceLen fails updates writing a sequence longer than n; see
+// Options.MaxSequenceLen.
+func WithMaxSequenceLen(n int) Option {
+	return func(o *Options) {
+		o.MaxSequenceLen = n
+	}
+}
+
+// WithPreserveTemplates keeps Go/Helm template actions verbatim; see
+// Options.PreserveTemplates.
+func WithPreserveTemplates() Option {
+	return func(o *Options) {
+		o.PreserveTemplates = true
+	}
+}
+
+// WithBoolStyle spells written booleans in style; see Options.BoolStyle.
+func WithBoolStyle(style BoolStyle) Option {
+	return func(o *Options) {
+		o.BoolStyle = style
+	}
+}
+
+// WithNormalizeTabs expands tabs in the indentation of the input; see
+// Options.NormalizeTabs.
+func WithNormalizeTabs() Option {
+	return func(o *Options) {
+		o.NormalizeTabs = true
+	}
+}
+
+// WithIndentDetector replaces the built-in indentation heuristic with detect;
+// see Options.IndentDetector.
+func WithIndentDetector(detect func(content []byte) int) Option {
+	return func(o *Options) {
+		o.IndentDetector = detect
+	}
+}
+
+// WithCoerceToExistingTag keeps the type existing scalars have in the file;
+// see Options.CoerceToExistingTag.
+func WithCoerceToExistingTag() Option {
+	return func(o *Options) {
+		o.CoerceToExistingTag = true
+	}
+}
+
+// WithSchema selects the YAML version written strings must survive; see
+// Options.Schema.
+func WithSchema(schema Schema) Option {
+	return func(o *Options) {
+		o.Schema = schema
+	}
+}
+
+// WithRootColumn indents the whole output by column spaces; see
+// Options.RootColumn.
+func WithRootColumn(column int) Option {
+	return func(o *Options) {
+		o.RootColumn = column
+	}
+}
+
+// WithCompactFlowThreshold writes small scalar collections in flow style; see
+// Options.CompactFlowThreshold.
+func WithCompactFlowThreshold(n int) Option {
+	return func(o *Options) {
+		o.CompactFlowThreshold = n
+	}
+}
+
+// WithScalarFormatter renders the scalars written with tag (e.g. "!!float")
+// with format; see Options.ScalarFormatters.
+func WithScalarFormatter(tag string, format func(reflect.Value) (value string, style yaml.Style)) Option {
+	return func(o *Options) {
+		formatters := make(map[string]func(reflect.Value) (string, yaml.Style), len(o.ScalarFormatters)+1)
+		for t, f := range o.ScalarFormatters {
+			formatters[t] = f
+		}
+		formatters[tag] = format
+		o.ScalarFormatters = formatters
+	}
+}
+
+// WithManagedRegion only updates keys between the begin and end marker
+// comments; see Options.ManagedRegion.
+func WithManagedRegion(begin, end string) Option {
+	return func(o *Options) {
+		o.ManagedRegion = [2]string{begin, end}
+	}
+}
+
+// WithFlowStylePaths forces the collections at paths to flow style; see
+// Options.FlowStylePaths.
+func WithFlowStylePaths(paths ...string) Option {
+	return func(o *Options) {
+		o.FlowStylePaths = append(o.FlowStylePaths, paths...)
+	}
+}
+
+// WithBlockStylePaths forces the collections at paths to block style; see
+// Options.BlockStylePaths.
+func WithBlockStylePaths(paths ...string) Option {
+	return func(o *Options) {
+		o.BlockStylePaths = append(o.BlockStylePaths, paths...)
+	}
+}
+
+// WithDedupScalarSequences drops repeated values from written scalar
+// sequences; see Options.DedupScalarSequences.
+func WithDedupScalarSequences() Option {
+	return func(o *Options) {
+		o.DedupScalarSequences = true
+	}
+}
+
+// WithCopyLineComments gives new keys the line comments of their neighbour;
+// see Options.CopyLineComments.
+func WithCopyLineComments() Option {
+	return func(o *Options) {
+		o.CopyLineComments = true
+	}
+}
+
+// WithOnKey calls fn for every key/value pair of the updated document; see
+// Options.OnKey.
+func WithOnKey(fn func(path string, key, value *yaml.Node)) Option {
+	return func(o *Options) {
+		o.OnKey = fn
+	}
+}
+
+// WithFieldFilter skips the struct fields keep returns false for; see
+// Options.FieldFilter.
+func WithFieldFilter(keep func(path string, field reflect.StructField) bool) Option {
+	return func(o *Options) {
+		o.FieldFilter = keep
+	}
+}
+
+// WithVerifyOutput re-parses the output before returning it; see
+// Options.VerifyOutput.
+func WithVerifyOutput() Option {
+	return func(o *Options) {
+		o.VerifyOutput = true
+	}
+}
+
+// WithVerifyScalars checks that written numbers decode back exactly; see
+// Options.VerifyScalars.
+func WithVerifyScalars() Option {
+	return func(o *Options) {
+		o.VerifyScalars = true
+	}
+}
+
+// WithSortKeys sorts the keys of every mapping, emitting pinned ones first;
+// see Options.SortKeys and Options.PinnedKeys.
+func WithSortKeys(pinned ...string) Option {
+	return func(o *Options) {
+		o.SortKeys = true
+		o.PinnedKeys = append(o.PinnedKeys, pinned...)
+	}
+}
+
+// WithKeyMatcher matches document keys with match when there is no exact
+// match; see Options.KeyMatcher.
+func WithKeyMatcher(match func(a, b string) bool) Option {
+	return func(o *Options) {
+		o.KeyMatcher = match
+	}
+}
+
+// WithKeyAlias renames the key from to to when the document has no key to;
+// see Options.KeyAliases.
+func WithKeyAlias(from, to string) Option {
+	return func(o *Options) {
+		aliases := make(map[string]string, len(o.KeyAliases)+1)
+		for k, v := range o.KeyAliases {
+			aliases[k] = v
+		}
+		aliases[from] = to
+		o.KeyAliases = aliases
+	}
+}
+
+// WithMaxChanges fails updates changing more than n scalar values; see
+// Options.MaxChanges.
+func WithMaxChanges(n int) Option {
+	return func(o *Options) {
+		o.MaxChanges = n
+	}
+}
+
+// WithAppendChecksum ends the output with a checksum line; see
+// Options.AppendChecksum.
+func WithAppendChecksum() Option {
+	return func(o *Options) {
+		o.AppendChecksum = true
+	}
+}
+
+// WithHeaderComment writes header at the top of the output, in place of the
+// document's own header if replace is set; see Options.HeaderComment.
+func WithHeaderComment(header string, replace bool) Option {
+	return func(o *Options) {
+		o.HeaderComment = header
+		o.ReplaceHeader = replace
+	}
+}
+
+// WithSubstitution replaces ${name} tokens in written strings with value; see
+// Options.Substitutions.
+func WithSubstitution(name, value string) Option {
+	return func(o *Options) {
+		substitutions := make(map[string]string, len(o.Substitutions)+1)
+		for k, v := range o.Substitutions {
+			substitutions[k] = v
+		}
+		substitutions[name] = value
+		o.Substitutions = substitutions
+	}
+}
+
+// WithFailOnUnknownSubstitution fails updates writing a ${name} token without
+// a substitution; see Options.FailOnUnknownSubstitution.
+func WithFailOnUnknownSubstitution() Option {
+	return func(o *Options) {
+		o.FailOnUnknownSubstitution = true
+	}
+}
+
+// WithOnlyFillEmpty only writes scalars that are empty or null; see
+// Options.OnlyFillEmpty.
+func WithOnlyFillEmpty() Option {
+	return func(o *Options) {
+		o.OnlyFillEmpty = true
+	}
+}
+
+// WithZeroValuePolicy selects how fields holding their zero value are
+// written; see Options.ZeroValuePolicy.
+func WithZeroValuePolicy(policy ZeroValuePolicy) Option {
+	return func(o *Options) {
+		o.ZeroValuePolicy = policy
+	}
+}
+
+func newOptions(opts []Option) Options {
+	var options Options
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
@@ -0,0 +1,69 @@
+package yaml
+
+import (
+	"testing"
+)
+
+func TestUpdateYAMLOptions(t *testing.T) {
+	type config struct {
+		Name   string            `json:"name"`
+		Ports  []int             `json:"ports"`
+		Note   string            `json:"note"`
+		Tags   []string          `json:"tags,omitempty"`
+		Labels map[string]string `json:"labels"`
+	}
+	content := []byte("# config\nname: old\nports: [1]\nlegacy: true\nnote: ${env} # set by ci\n")
+	data := config{Name: "api", Ports: []int{80, 443}, Note: "${env}", Labels: map[string]string{"tier": "web", "app": "api", "env": "prod", "team": "core"}}
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		options Options
+	}{
+		{
+			name: "no options",
+		},
+		{
+			name:    "helpers match the fields they set",
+			opts:    []Option{WithTagName("json"), WithPruneUnknownKeys(), WithIndent(4), WithSubstitution("env", "prod"), WithBlockStylePaths("ports"), WithHeaderComment("generated", true)},
+			options: Options{TagName: "json", PruneUnknownKeys: true, IndentDetector: func([]byte) int { return 4 }, Substitutions: map[string]string{"env": "prod"}, BlockStylePaths: []string{"ports"}, HeaderComment: "generated", ReplaceHeader: true},
+		},
+		{
+			name:    "later options adjust WithOptions",
+			opts:    []Option{WithOptions(Options{TagName: "json", SortKeys: true}), WithRootColumn(2)},
+			options: Options{TagName: "json", SortKeys: true, RootColumn: 2},
+		},
+		{
+			name:    "WithOptions replaces earlier options",
+			opts:    []Option{WithPruneUnknownKeys(), WithOptions(Options{TagName: "json"})},
+			options: Options{TagName: "json"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UpdateYAML(content, data, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := UpdateYAMLWithOptions(content, data, tt.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("got:\n%q\nwant:\n%q", got, want)
+			}
+
+			// Map entries are added in a fixed order whatever the options
+			for i := 0; i < 100; i++ {
+				again, err := UpdateYAML(content, data, tt.opts...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(again) != string(got) {
+					t.Fatalf("run %d got:\n%q\nwant:\n%q", i, again, got)
+				}
+			}
+		})
+	}
+}
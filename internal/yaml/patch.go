@@ -0,0 +1,210 @@
+package yaml
+
+import (
+	"fmt"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PatchOp is a single RFC 6902-style operation. Path and From use the dotted
+// path syntax of Document, e.g. "skills.programming[0].level".
+type PatchOp struct {
+	// Op is one of "add", "remove", "replace", "move", "copy" or "test".
+	Op   string
+	Path string
+	// From is the source path of "move" and "copy".
+	From string
+	// Value is the value of "add", "replace" and "test".
+	Value interface{}
+}
+
+// ApplyPatch applies patch to content in order, preserving the formatting of
+// everything it does not touch. Like JSON Patch, "add" inserts into a
+// sequence at the given index (an index equal to the length appends), while
+// on a mapping it creates or replaces the key. If any operation fails,
+// including a "test" whose value does not match, no change is returned.
+func ApplyPatch(content []byte, patch []PatchOp) ([]byte, error) {
+	doc, err := Parse(content)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, op := range patch {
+		if err := doc.apply(op); err != nil {
+			return nil, fmt.Errorf("patch operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+
+	return doc.Bytes()
+}
+
+func (d *Document) apply(op PatchOp) error {
+	switch op.Op {
+	case "add":
+		node, err := d.valueNode(op.Value)
+		if err != nil {
+			return err
+		}
+		return d.insert(op.Path, node, nil)
+	case "remove":
+		return d.Delete(op.Path)
+	case "replace":
+		if _, err := d.lookup(op.Path); err != nil {
+			return err
+		}
+		return d.Set(op.Path, op.Value)
+	case "move":
+		node, err := d.lookup(op.From)
+		if err != nil {
+			return err
+		}
+		from, err := d.keyNode(op.From)
+		if err != nil {
+			return err
+		}
+		if err := d.Delete(op.From); err != nil {
+			return err
+		}
+		return d.insert(op.Path, node, from)
+	case "copy":
+		node, err := d.lookup(op.From)
+		if err != nil {
+			return err
+		}
+		return d.insert(op.Path, copyNode(node), nil)
+	case "test":
+		return d.test(op.Path, op.Value)
+	default:
+		return fmt.Errorf("unknown patch operation %q", op.Op)
+	}
+}
+
+// insert places node at path: into a sequence at the addressed index, or as
+// the value of the addressed mapping key, keeping an existing key node. The
+// head and line comments of from, the key node was moved away from, go along
+// with it unless the destination has comments of its own.
+func (d *Document) insert(path string, node, from *yaml.Node) error {
+	segments, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 {
+		return fmt.Errorf("cannot replace the document root")
+	}
+
+	parent, err := lookupPath(d.body(), segments[:len(segments)-1])
+	if err != nil {
+		return err
+	}
+
+	last := segments[len(segments)-1]
+	if last.isIndex {
+		if parent.Kind != yaml.SequenceNode {
+			return fmt.Errorf("%s is not a sequence", formatPath(segments[:len(segments)-1]))
+		}
+		if last.index > len(parent.Content) {
+			return fmt.Errorf("index %d out of range", last.index)
+		}
+		parent.Content = append(parent.Content[:last.index], append([]*yaml.Node{node}, parent.Content[last.index:]...)...)
+		if from != nil {
+			carryComments(node, node, from)
+		}
+		return nil
+	}
+
+	if parent.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s is not a mapping", formatPath(segments[:len(segments)-1]))
+	}
+	keyNode, _, found := findNodes(parent, last.key)
+	if found {
+		for i := 0; i < len(parent.Content); i += 2 {
+			if parent.Content[i] == keyNode {
+				parent.Content[i+1] = node
+			}
+		}
+	} else {
+		keyNode = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: last.key}
+		parent.Content = append(parent.Content, keyNode, node)
+	}
+	if from != nil {
+		carryComments(keyNode, node, from)
+	}
+	return nil
+}
+
+// keyNode returns the key node of the mapping entry at path, or nil if path
+// addresses a sequence item.
+func (d *Document) keyNode(path string) (*yaml.Node, error) {
+	segments, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) == 0 || segments[len(segments)-1].isIndex {
+		return nil, nil
+	}
+	parent, err := lookupPath(d.body(), segments[:len(segments)-1])
+	if err != nil {
+		return nil, err
+	}
+	keyNode, _, _ := findNodes(parent, segments[len(segments)-1].key)
+	return keyNode, nil
+}
+
+// carryComments gives the entry made of keyNode and value, which is the same
+// node for a sequence item, the comments of the moved key node from.
+func carryComments(keyNode, value, from *yaml.Node) {
+	if keyNode.HeadComment == "" {
+		keyNode.HeadComment = from.HeadComment
+	}
+	target := keyNode
+	if value.Kind == yaml.ScalarNode {
+		target = value
+	}
+	if keyNode.LineComment == "" && value.LineComment == "" {
+		target.LineComment = from.LineComment
+	}
+}
+
+// test fails unless the value at path equals value once both are seen as YAML.
+func (d *Document) test(path string, value interface{}) error {
+	actual, err := d.Get(path)
+	if err != nil {
+		return err
+	}
+
+	expectedNode, err := d.valueNode(value)
+	if err != nil {
+		return err
+	}
+	var expected interface{}
+	if err := expectedNode.Decode(&expected); err != nil {
+		return err
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		return fmt.Errorf("test failed: %s is %v, not %v", path, actual, expected)
+	}
+	return nil
+}
+
+// valueNode builds a fresh node for value.
+func (d *Document) valueNode(value interface{}) (*yaml.Node, error) {
+	node := &yaml.Node{}
+	if err := newUpdater(Options{}).updateNode(node, reflect.ValueOf(&value).Elem()); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// copyNode returns a deep copy of node. Aliases keep pointing at their anchors.
+func copyNode(node *yaml.Node) *yaml.Node {
+	dup := *node
+	dup.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		dup.Content[i] = copyNode(child)
+	}
+	// The copy must not define the same anchor a second time
+	dup.Anchor = ""
+	return &dup
+}
@@ -0,0 +1,106 @@
+package yaml
+
+import (
+	"testing"
+)
+
+func TestApplyPatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		patch   []PatchOp
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "add a key",
+			content: "a: 1\n",
+			patch:   []PatchOp{{Op: "add", Path: "b", Value: "x"}},
+			want:    "a: 1\nb: x\n",
+		},
+		{
+			name:    "add inserts into a sequence",
+			content: "l:\n- x\n- z\n",
+			patch:   []PatchOp{{Op: "add", Path: "l[1]", Value: "y"}},
+			want:    "l:\n- x\n- y\n- z\n",
+		},
+		{
+			name:    "add appends to a sequence",
+			content: "l:\n- x\n",
+			patch:   []PatchOp{{Op: "add", Path: "l[1]", Value: "y"}},
+			want:    "l:\n- x\n- y\n",
+		},
+		{
+			name:    "remove",
+			content: "a: 1\nb: 2\n",
+			patch:   []PatchOp{{Op: "remove", Path: "a"}},
+			want:    "b: 2\n",
+		},
+		{
+			name:    "replace keeps the line comment",
+			content: "a: 1 # note\n",
+			patch:   []PatchOp{{Op: "replace", Path: "a", Value: 2}},
+			want:    "a: 2 # note\n",
+		},
+		{
+			name:    "replace a missing key",
+			content: "a: 1\n",
+			patch:   []PatchOp{{Op: "replace", Path: "b", Value: 2}},
+			wantErr: true,
+		},
+		{
+			name:    "move keeps the comments",
+			content: "# about a\na: 1 # note\nb:\n  c: 2\n",
+			patch:   []PatchOp{{Op: "move", From: "a", Path: "b.a"}},
+			want:    "b:\n  c: 2\n  # about a\n  a: 1 # note\n",
+		},
+		{
+			name:    "copy",
+			content: "a:\n  x: 1\n",
+			patch:   []PatchOp{{Op: "copy", From: "a", Path: "b"}},
+			want:    "a:\n  x: 1\nb:\n  x: 1\n",
+		},
+		{
+			name:    "test passes",
+			content: "a: 1\n",
+			patch:   []PatchOp{{Op: "test", Path: "a", Value: 1}, {Op: "replace", Path: "a", Value: 2}},
+			want:    "a: 2\n",
+		},
+		{
+			name:    "failed test applies nothing",
+			content: "a: 1\n",
+			patch:   []PatchOp{{Op: "replace", Path: "a", Value: 2}, {Op: "test", Path: "a", Value: 3}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown operation",
+			content: "a: 1\n",
+			patch:   []PatchOp{{Op: "frobnicate", Path: "a"}},
+			wantErr: true,
+		},
+		{
+			name:    "rest of the file is kept",
+			content: "\ufeffname: a\nlist:\n- x\n\n- y\n",
+			patch:   []PatchOp{{Op: "replace", Path: "name", Value: "b"}},
+			want:    "\ufeffname: b\nlist:\n- x\n\n- y\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := ApplyPatch([]byte(tt.content), tt.patch)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got:\n%s", out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
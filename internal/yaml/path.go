@@ -0,0 +1,172 @@
+package yaml
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// pathSegment is one step of a dotted path: either a mapping key or a sequence index.
+type pathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+func (s pathSegment) String() string {
+	if s.isIndex {
+		return fmt.Sprintf("[%d]", s.index)
+	}
+	if strings.ContainsAny(s.key, `.[]\"`) {
+		return fmt.Sprintf("[%s]", strconv.Quote(s.key))
+	}
+	return s.key
+}
+
+// parsePath splits a path such as "skills.programming[0].level" into its segments.
+// The empty path addresses the document root. Keys containing dots or brackets
+// are written either with backslash escapes (application\.properties) or
+// quoted in brackets (["application.properties"]).
+func parsePath(path string) ([]pathSegment, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	var segments []pathSegment
+	var key strings.Builder
+	hasKey := false
+	// expectKey is set at the start and after each dot, where a key must follow
+	expectKey := true
+
+	flush := func() {
+		if hasKey {
+			segments = append(segments, pathSegment{key: key.String()})
+			key.Reset()
+			hasKey = false
+		}
+	}
+
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; c {
+		case '\\':
+			if i+1 == len(path) {
+				return nil, fmt.Errorf("invalid path %q: trailing \\", path)
+			}
+			i++
+			key.WriteByte(path[i])
+			hasKey, expectKey = true, false
+		case '.':
+			if expectKey && !hasKey {
+				return nil, fmt.Errorf("invalid path %q: empty segment", path)
+			}
+			flush()
+			expectKey = true
+		case '[':
+			flush()
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %q: missing ]", path)
+			}
+			if path[i+1] == '"' {
+				quoted, err := strconv.QuotedPrefix(path[i+1:])
+				if err != nil {
+					return nil, fmt.Errorf("invalid path %q: bad quoted key", path)
+				}
+				closing := i + 1 + len(quoted)
+				if closing >= len(path) || path[closing] != ']' {
+					return nil, fmt.Errorf("invalid path %q: missing ]", path)
+				}
+				name, _ := strconv.Unquote(quoted)
+				segments = append(segments, pathSegment{key: name})
+				i = closing
+			} else {
+				index, err := strconv.Atoi(path[i+1 : i+end])
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("invalid path %q: bad index %q", path, path[i+1:i+end])
+				}
+				segments = append(segments, pathSegment{index: index, isIndex: true})
+				i += end
+			}
+			expectKey = false
+			if i+1 < len(path) && path[i+1] != '.' && path[i+1] != '[' {
+				return nil, fmt.Errorf("invalid path %q: unexpected %q", path, path[i+1:])
+			}
+		default:
+			key.WriteByte(c)
+			hasKey, expectKey = true, false
+		}
+	}
+
+	if expectKey && !hasKey {
+		return nil, fmt.Errorf("invalid path %q: empty segment", path)
+	}
+	flush()
+	return segments, nil
+}
+
+// lookupPath walks segments from node and returns the node they address.
+func lookupPath(node *yaml.Node, segments []pathSegment) (*yaml.Node, error) {
+	for i, segment := range segments {
+		child, ok := childNode(node, segment)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrPathNotFound, formatPath(segments[:i+1]))
+		}
+		node = child
+	}
+	return node, nil
+}
+
+// childNode returns the value addressed by a single segment below node.
+func childNode(node *yaml.Node, segment pathSegment) (*yaml.Node, bool) {
+	if node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	if segment.isIndex {
+		if node.Kind != yaml.SequenceNode || segment.index >= len(node.Content) {
+			return nil, false
+		}
+		return node.Content[segment.index], true
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil, false
+	}
+	_, valueNode, found := findNodes(node, segment.key)
+	return valueNode, found
+}
+
+// walkPairs calls fn for every key/value pair below node, parents before their
+// children, with the path of the pair. Children are visited under the key as
+// fn left it; aliases are not followed.
+func walkPairs(node *yaml.Node, path []pathSegment, fn func(path string, key, value *yaml.Node)) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			walkPairs(child, path, fn)
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			walkPairs(child, append(path, pathSegment{index: i, isIndex: true}), fn)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			fn(formatPath(append(path, pathSegment{key: keyValue(key)})), key, value)
+			walkPairs(value, append(path, pathSegment{key: keyValue(key)}), fn)
+		}
+	}
+}
+
+// formatPath renders segments back into their dotted form.
+func formatPath(segments []pathSegment) string {
+	var sb strings.Builder
+	for _, segment := range segments {
+		str := segment.String()
+		if sb.Len() > 0 && !strings.HasPrefix(str, "[") {
+			sb.WriteByte('.')
+		}
+		sb.WriteString(str)
+	}
+	return sb.String()
+}
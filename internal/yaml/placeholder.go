@@ -0,0 +1,17 @@
+package yaml
+
+import "reflect"
+
+// Placeholder is a value that blanks out a key and leaves a comment in its
+// place, such as `key: # fill me`. Create one with TODO.
+type Placeholder struct {
+	Comment string
+}
+
+// TODO returns a Placeholder that writes a null value with comment as its
+// trailing comment. Assign it to an interface{} field or map value.
+func TODO(comment string) Placeholder {
+	return Placeholder{Comment: comment}
+}
+
+var placeholderType = reflect.TypeOf(Placeholder{})
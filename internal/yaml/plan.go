@@ -0,0 +1,158 @@
+package yaml
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PlanAction is the kind of change a PlannedChange describes.
+type PlanAction string
+
+const (
+	PlanAdd    PlanAction = "add"
+	PlanUpdate PlanAction = "update"
+	PlanRemove PlanAction = "remove"
+)
+
+// PlannedChange is a single operation an update would perform. Path uses dotted
+// keys and [i] for sequence indices, e.g. "skills.programming[0].level".
+type PlannedChange struct {
+	Action PlanAction
+	Path   string
+	Old    interface{}
+	New    interface{}
+}
+
+// UpdatePlan lists the changes an update would make to a document.
+type UpdatePlan struct {
+	Changes []PlannedChange
+}
+
+// Plan computes what UpdateYAML would change in content without encoding
+// anything, similar to `terraform plan`: added, updated and removed keys and
+// sequence items. opts tune the update as for UpdateYAML, so e.g.
+// WithPruneUnknownKeys makes the plan list the keys pruning would remove.
+func Plan(content []byte, data interface{}, opts ...Option) (*UpdatePlan, error) {
+	before, after, err := updateCopy(content, data, newOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &UpdatePlan{}
+	if err := plan.diff("", documentBody(&before.root), documentBody(&after.root)); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// PlanPrune returns the dotted paths of the keys an update with
+// PruneUnknownKeys would remove from content, without changing anything.
+// opts tune the update as for UpdateYAML, e.g. WithTagName decides which
+// keys the struct fields of data map to; pruning is always on.
+func PlanPrune(content []byte, data interface{}, opts ...Option) ([]string, error) {
+	options := newOptions(opts)
+	options.PruneUnknownKeys = true
+
+	doc, err := parseDocument(content, options)
+	if err != nil {
+		return nil, err
+	}
+	u := newUpdater(options)
+	if err := u.update(doc, data); err != nil {
+		return nil, err
+	}
+	return u.pruned, nil
+}
+
+// String renders the plan one change per line: "+" for additions, "~" for
+// updates and "-" for removals.
+func (p *UpdatePlan) String() string {
+	var sb strings.Builder
+	for _, c := range p.Changes {
+		switch c.Action {
+		case PlanAdd:
+			fmt.Fprintf(&sb, "+ %s: %v\n", c.Path, c.New)
+		case PlanUpdate:
+			fmt.Fprintf(&sb, "~ %s: %v -> %v\n", c.Path, c.Old, c.New)
+		case PlanRemove:
+			fmt.Fprintf(&sb, "- %s: %v\n", c.Path, c.Old)
+		}
+	}
+	return sb.String()
+}
+
+func (p *UpdatePlan) diff(path string, before, after *yaml.Node) error {
+	switch {
+	case before.Kind == yaml.MappingNode && after.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(after.Content); i += 2 {
+			key := keyValue(after.Content[i])
+			_, oldValue, found := findNodes(before, key)
+			if !found {
+				if err := p.add(PlanAdd, joinPath(path, key), nil, after.Content[i+1]); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := p.diff(joinPath(path, key), oldValue, after.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		for i := 0; i+1 < len(before.Content); i += 2 {
+			key := keyValue(before.Content[i])
+			if _, _, found := findNodes(after, key); !found {
+				if err := p.add(PlanRemove, joinPath(path, key), before.Content[i+1], nil); err != nil {
+					return err
+				}
+			}
+		}
+	case before.Kind == yaml.SequenceNode && after.Kind == yaml.SequenceNode:
+		for i, elem := range after.Content {
+			elemPath := fmt.Sprintf("%s[%d]", path, i)
+			if i >= len(before.Content) {
+				if err := p.add(PlanAdd, elemPath, nil, elem); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := p.diff(elemPath, before.Content[i], elem); err != nil {
+				return err
+			}
+		}
+		for i := len(after.Content); i < len(before.Content); i++ {
+			if err := p.add(PlanRemove, fmt.Sprintf("%s[%d]", path, i), before.Content[i], nil); err != nil {
+				return err
+			}
+		}
+	case !nodesEqual(before, after):
+		return p.add(PlanUpdate, path, before, after)
+	}
+	return nil
+}
+
+func (p *UpdatePlan) add(action PlanAction, path string, before, after *yaml.Node) error {
+	change := PlannedChange{Action: action, Path: path}
+	if before != nil {
+		if err := before.Decode(&change.Old); err != nil {
+			return fmt.Errorf("failed to decode %s: %w", path, err)
+		}
+	}
+	if after != nil {
+		if err := after.Decode(&change.New); err != nil {
+			return fmt.Errorf("failed to decode %s: %w", path, err)
+		}
+	}
+	p.Changes = append(p.Changes, change)
+	return nil
+}
+
+// joinPath appends key to a dotted path, quoted like formatPath does when it
+// holds dots or brackets.
+func joinPath(path, key string) string {
+	segment := pathSegment{key: key}.String()
+	if path == "" || strings.HasPrefix(segment, "[") {
+		return path + segment
+	}
+	return path + "." + segment
+}
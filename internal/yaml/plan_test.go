@@ -0,0 +1,157 @@
+package yaml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	content, person := readTestPerson(t)
+	mixed := person
+	mixed.Age = 31
+	mixed.Hobbies = append([]string{}, person.Hobbies[:2]...)
+	mixed.Details.Phones = append(append([]string{}, person.Details.Phones...), "555-8910")
+
+	type partial struct {
+		Name string `yaml:"name"`
+	}
+
+	tests := []struct {
+		name    string
+		content []byte
+		data    interface{}
+		opts    []Option
+		want    []PlannedChange
+	}{
+		{
+			name:    "mixed change",
+			content: content,
+			data:    mixed,
+			want: []PlannedChange{
+				{Action: PlanUpdate, Path: "age", Old: 30, New: 31},
+				{Action: PlanRemove, Path: "hobbies[2]", Old: "mountain climbing"},
+				{Action: PlanAdd, Path: "details.phones[2]", New: "555-8910"},
+			},
+		},
+		{
+			name:    "nested map entries removed",
+			content: []byte("a: 1\nb:\n  c: 2\n  d: 3\n  e:\n    f: 4\n"),
+			data:    map[string]interface{}{"a": 1, "b": map[string]interface{}{"c": 2}},
+			want: []PlannedChange{
+				{Action: PlanRemove, Path: "b.d", Old: 3},
+				{Action: PlanRemove, Path: "b.e", Old: map[string]interface{}{"f": 4}},
+			},
+		},
+		{
+			name:    "pruned struct keys",
+			content: []byte("name: x\nextra:\n  deep: 1\n"),
+			data:    partial{Name: "y"},
+			opts:    []Option{WithPruneUnknownKeys()},
+			want: []PlannedChange{
+				{Action: PlanUpdate, Path: "name", Old: "x", New: "y"},
+				{Action: PlanRemove, Path: "extra", Old: map[string]interface{}{"deep": 1}},
+			},
+		},
+		{
+			name:    "dotted keys",
+			content: []byte("app.properties:\n  level: 1\n  x[0]: a\n"),
+			data:    map[string]interface{}{"app.properties": map[string]interface{}{"level": 2}},
+			want: []PlannedChange{
+				{Action: PlanUpdate, Path: `["app.properties"].level`, Old: 1, New: 2},
+				{Action: PlanRemove, Path: `["app.properties"]["x[0]"]`, Old: "a"},
+			},
+		},
+		{
+			name:    "unknown struct keys kept by default",
+			content: []byte("name: x\nextra: 1\n"),
+			data:    partial{Name: "x"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := Plan(tt.content, tt.data, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(plan.Changes, tt.want) {
+				t.Errorf("got %#v\nwant %#v", plan.Changes, tt.want)
+			}
+
+			// Paths of updated values address them again
+			for _, change := range plan.Changes {
+				if change.Action != PlanUpdate {
+					continue
+				}
+				if _, err := SetValueAtPath(tt.content, change.Path, change.New); err != nil {
+					t.Errorf("path %q: %v", change.Path, err)
+				}
+			}
+		})
+	}
+}
+
+func TestPlanPrune(t *testing.T) {
+	type apiConfig struct {
+		UserName string `json:"user_name"`
+		Port     int    `json:"port"`
+	}
+	content := []byte("user_name: x # keep\nport: 80\nlegacy: true\nold_name: y\n")
+
+	tests := []struct {
+		name    string
+		content []byte
+		opts    []Option
+		want    []string
+	}{
+		{
+			name:    "json tags",
+			content: content,
+			opts:    []Option{WithTagName("json")},
+			want:    []string{"legacy", "old_name"},
+		},
+		{
+			name:    "json tags with an alias",
+			content: []byte("old_name: x\nport: 80\nlegacy: true\n"),
+			opts:    []Option{WithTagName("json"), WithKeyAlias("old_name", "user_name")},
+			want:    []string{"legacy"},
+		},
+		{
+			name:    "dotted keys",
+			content: []byte("user_name: x\nport: 80\nlegacy.flag: true\n"),
+			opts:    []Option{WithTagName("json")},
+			want:    []string{`["legacy.flag"]`},
+		},
+		{
+			name:    "yaml tags by default",
+			content: content,
+			want:    []string{"user_name", "port", "legacy", "old_name"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := apiConfig{UserName: "x", Port: 80}
+			got, err := PlanPrune(tt.content, data, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+
+			// The plan matches what the update removes
+			opts := append([]Option{WithPruneUnknownKeys()}, tt.opts...)
+			out, err := UpdateYAML(tt.content, data, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range tt.want {
+				if strings.Contains(string(out), key+":") {
+					t.Errorf("update kept %s:\n%s", key, out)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package yaml
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// managedRegions returns the line ranges, 1-based and exclusive of the marker
+// lines, enclosed by the begin and end markers of Options.ManagedRegion. A
+// marker matches a comment line with or without its leading "# ". A region
+// left open runs to the end of content.
+func managedRegions(content []byte, markers [2]string) [][2]int {
+	isMarker := func(line []byte, marker string) bool {
+		text := strings.TrimSpace(string(line))
+		marker = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(marker), "#"))
+		return strings.HasPrefix(text, "#") && strings.TrimSpace(strings.TrimPrefix(text, "#")) == marker
+	}
+
+	lines := bytes.Split(content, []byte("\n"))
+	var regions [][2]int
+	begin := -1
+	for i, line := range lines {
+		switch {
+		case begin < 0 && isMarker(line, markers[0]):
+			begin = i + 1
+		case begin >= 0 && isMarker(line, markers[1]):
+			regions = append(regions, [2]int{begin, i + 1})
+			begin = -1
+		}
+	}
+	if begin >= 0 {
+		regions = append(regions, [2]int{begin, len(lines) + 1})
+	}
+	return regions
+}
+
+// managed reports whether the key at line may be updated under
+// Options.ManagedRegion. Without a region every key is managed.
+func (u *updater) managed(line int) bool {
+	if u.opts.ManagedRegion == [2]string{} {
+		return true
+	}
+	for _, region := range u.regions {
+		if line > region[0] && line < region[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// updateUnmanaged descends into a value outside the managed region so that
+// the keys nested in it that do fall inside the region are still updated.
+// The value itself is left alone.
+func (u *updater) updateUnmanaged(node *yaml.Node, value reflect.Value) error {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		return u.updateYamlFromStruct(node, value.Interface())
+	case reflect.Map:
+		if value.Type().Key().Kind() == reflect.String {
+			return u.updateMapEntries(node, value, nil)
+		}
+	}
+	return nil
+}
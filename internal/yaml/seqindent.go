@@ -0,0 +1,148 @@
+package yaml
+
+import (
+	"bytes"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// blockScalarHeader matches a line ending in a literal or folded block scalar indicator.
+var blockScalarHeader = regexp.MustCompile(`[:-]\s+[|>][-+0-9]*\s*(#.*)?$|^\s*[|>][-+0-9]*\s*(#.*)?$`)
+
+// detectSequenceIndent returns how far the dashes of block sequences nested in
+// a mapping sit from their key, e.g. 0 for
+//
+//	key:
+//	- item
+//
+// and 2 for the "indented" style. It reports false if the document has no such sequence.
+func detectSequenceIndent(node *yaml.Node) (int, bool) {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if value.Kind == yaml.SequenceNode && value.Style&yaml.FlowStyle == 0 && len(value.Content) > 0 &&
+				value.Line > key.Line {
+				return value.Column - key.Column, true
+			}
+		}
+	}
+	for _, child := range node.Content {
+		if indent, ok := detectSequenceIndent(child); ok {
+			return indent, true
+		}
+	}
+	return 0, false
+}
+
+// reindentSequences moves every block sequence nested in a mapping of the
+// encoded content so that its dashes sit seqIndent columns right of the key,
+// along with everything nested in it. The encoder always indents sequences
+// by its own rules, this restores the layout of the original file.
+func reindentSequences(content []byte, seqIndent int) []byte {
+	type shift struct {
+		keyColumn int
+		delta     int
+	}
+
+	lines := bytes.Split(content, []byte("\n"))
+	var stack []shift
+	prevKeyColumn := -1
+	blockParent := -1
+
+	for i, line := range lines {
+		trimmed := bytes.TrimLeft(line, " ")
+		indent := len(line) - len(trimmed)
+		if len(trimmed) == 0 {
+			continue
+		}
+
+		for len(stack) > 0 && indent <= stack[len(stack)-1].keyColumn {
+			stack = stack[:len(stack)-1]
+		}
+
+		inBlockScalar := blockParent >= 0 && indent > blockParent
+		isComment := !inBlockScalar && trimmed[0] == '#'
+		if !inBlockScalar {
+			blockParent = -1
+			// Head comments of the first entry move along with the sequence
+			entry, entryIndent := trimmed, indent
+			if isComment {
+				entry, entryIndent = nextEntry(lines[i+1:])
+			}
+			if prevKeyColumn >= 0 && entryIndent > prevKeyColumn && isDashLine(entry) {
+				if delta := entryIndent - prevKeyColumn - seqIndent; delta != 0 {
+					stack = append(stack, shift{keyColumn: prevKeyColumn, delta: delta})
+				}
+				prevKeyColumn = -1
+			}
+		}
+
+		total := 0
+		for _, s := range stack {
+			total += s.delta
+		}
+		if total > indent {
+			total = indent
+		}
+		if total > 0 {
+			lines[i] = line[total:]
+		} else if total < 0 {
+			lines[i] = append(bytes.Repeat([]byte(" "), -total), line...)
+		}
+
+		if inBlockScalar || isComment {
+			continue
+		}
+
+		prevKeyColumn = -1
+		column := contentColumn(line)
+		if endsWithKey(line) {
+			prevKeyColumn = column
+		}
+		if blockScalarHeader.Match(line) {
+			blockParent = column
+		}
+	}
+
+	return bytes.Join(lines, []byte("\n"))
+}
+
+// nextEntry returns the first line of lines that is neither blank nor a
+// comment, without its indentation, along with that indentation.
+func nextEntry(lines [][]byte) ([]byte, int) {
+	for _, line := range lines {
+		trimmed := bytes.TrimLeft(line, " ")
+		if len(trimmed) > 0 && trimmed[0] != '#' {
+			return trimmed, len(line) - len(trimmed)
+		}
+	}
+	return nil, -1
+}
+
+// isDashLine reports whether a line, without its indentation, is a block sequence entry.
+func isDashLine(trimmed []byte) bool {
+	return bytes.Equal(trimmed, []byte("-")) || bytes.HasPrefix(trimmed, []byte("- "))
+}
+
+// contentColumn returns the column of a line's content after any "- " entry markers.
+func contentColumn(line []byte) int {
+	column := len(line) - len(bytes.TrimLeft(line, " "))
+	for bytes.HasPrefix(line[column:], []byte("- ")) {
+		column += 2
+		for column < len(line) && line[column] == ' ' {
+			column++
+		}
+	}
+	return column
+}
+
+// endsWithKey reports whether a line opens a block collection, i.e. it is a
+// mapping key with nothing but an optional comment after the colon.
+func endsWithKey(line []byte) bool {
+	if i := bytes.Index(line, []byte(" #")); i >= 0 {
+		line = line[:i]
+	}
+	line = bytes.TrimRight(line, " ")
+	return bytes.HasSuffix(line, []byte(":"))
+}
@@ -0,0 +1,22 @@
+package yaml
+
+// SetInt writes the integer v at path in content, tagged !!int.
+func SetInt(content []byte, path string, v int64) ([]byte, error) {
+	return SetValueAtPath(content, path, v)
+}
+
+// SetFloat writes the float v at path in content, tagged !!float.
+func SetFloat(content []byte, path string, v float64) ([]byte, error) {
+	return SetValueAtPath(content, path, v)
+}
+
+// SetBool writes the boolean v at path in content, tagged !!bool.
+func SetBool(content []byte, path string, v bool) ([]byte, error) {
+	return SetValueAtPath(content, path, v)
+}
+
+// SetString writes the string v at path in content, tagged !!str and quoted
+// where it would otherwise read as another type, e.g. "true" or "42".
+func SetString(content []byte, path string, v string) ([]byte, error) {
+	return SetValueAtPath(content, path, v)
+}
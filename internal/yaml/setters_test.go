@@ -0,0 +1,67 @@
+package yaml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTypedSetters(t *testing.T) {
+	content := "\ufeff# settings\nport: 80 # http\nratio: 0.5\ndebug: false\nname: web\nhosts:\n- a\n\n- b\n"
+	replace := func(old, new string) string {
+		return strings.Replace(content, old, new, 1)
+	}
+
+	tests := []struct {
+		name string
+		set  func([]byte) ([]byte, error)
+		want string
+	}{
+		{
+			name: "int",
+			set:  func(c []byte) ([]byte, error) { return SetInt(c, "port", 8080) },
+			want: replace("port: 80 #", "port: 8080 #"),
+		},
+		{
+			name: "float",
+			set:  func(c []byte) ([]byte, error) { return SetFloat(c, "ratio", 2) },
+			want: replace("ratio: 0.5", "ratio: 2.0"),
+		},
+		{
+			name: "bool",
+			set:  func(c []byte) ([]byte, error) { return SetBool(c, "debug", true) },
+			want: replace("debug: false", "debug: true"),
+		},
+		{
+			name: "string",
+			set:  func(c []byte) ([]byte, error) { return SetString(c, "name", "api") },
+			want: replace("name: web", "name: api"),
+		},
+		{
+			name: "string that reads as a bool",
+			set:  func(c []byte) ([]byte, error) { return SetString(c, "name", "true") },
+			want: replace("name: web", `name: "true"`),
+		},
+		{
+			name: "sequence item",
+			set:  func(c []byte) ([]byte, error) { return SetString(c, "hosts[1]", "c") },
+			want: replace("- b", "- c"),
+		},
+		{
+			name: "new key",
+			set:  func(c []byte) ([]byte, error) { return SetInt(c, "workers", 4) },
+			want: content + "workers: 4\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := tt.set([]byte(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
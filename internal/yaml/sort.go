@@ -0,0 +1,71 @@
+package yaml
+
+import (
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// sortDocumentKeys sorts the mappings of the document root like
+// sortMappingKeys. The part of the first key's head comment that reads as the
+// document's header, as setHeaderComment tells it apart, stays at the top
+// instead of moving along with the key.
+func sortDocumentKeys(root *yaml.Node, pinned []string) {
+	var header string
+	if first := firstKey(root); first != nil {
+		if i := strings.LastIndex(first.HeadComment, "\n\n"); i >= 0 {
+			header, first.HeadComment = first.HeadComment[:i], first.HeadComment[i+2:]
+		} else if root.HeadComment == "" {
+			header, first.HeadComment = first.HeadComment, ""
+		}
+	}
+
+	sortMappingKeys(root, pinned)
+
+	if first := firstKey(root); first != nil && header != "" {
+		if first.HeadComment != "" {
+			header += "\n\n" + first.HeadComment
+		}
+		first.HeadComment = header
+	}
+}
+
+// sortMappingKeys reorders the pairs of every mapping below node: keys listed
+// in pinned come first in that order, all others follow sorted by name.
+// Comments move along with their keys.
+func sortMappingKeys(node *yaml.Node, pinned []string) {
+	if node.Kind == yaml.MappingNode {
+		rank := make(map[string]int, len(pinned))
+		for i, key := range pinned {
+			if _, ok := rank[key]; !ok {
+				rank[key] = i
+			}
+		}
+
+		pairs := make([][2]*yaml.Node, 0, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			pairs = append(pairs, [2]*yaml.Node{node.Content[i], node.Content[i+1]})
+		}
+		sort.SliceStable(pairs, func(i, j int) bool {
+			a, b := keyValue(pairs[i][0]), keyValue(pairs[j][0])
+			ra, pinnedA := rank[a]
+			rb, pinnedB := rank[b]
+			switch {
+			case pinnedA && pinnedB:
+				return ra < rb
+			case pinnedA || pinnedB:
+				return pinnedA
+			default:
+				return a < b
+			}
+		})
+		for i, pair := range pairs {
+			node.Content[2*i], node.Content[2*i+1] = pair[0], pair[1]
+		}
+	}
+
+	for _, child := range node.Content {
+		sortMappingKeys(child, pinned)
+	}
+}
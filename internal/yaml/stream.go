@@ -0,0 +1,99 @@
+package yaml
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// streamPeekSize is how much of a stream StreamUpdate reads ahead to detect
+// its indentation.
+const streamPeekSize = 64 << 10
+
+// StreamUpdate copies the YAML documents of r to w one at a time, calling
+// handler for every scalar value with its dotted path, e.g.
+// "skills.programming[0].level". A non-nil node returned by handler replaces
+// the scalar, taking over its comments unless it brings its own; nil keeps it.
+//
+// yaml.v3 exposes no event API, so this is best effort: streaming happens per
+// document, not per event. Each document is decoded into a node tree on its
+// own, which bounds memory by the largest single document instead of the whole
+// stream; one huge document is still loaded whole. Documents are re-encoded
+// with the indentation detected from the start of the stream (or set by
+// WithIndent), keeping comments and scalar styles but not blank lines; use
+// UpdateYAML when those matter.
+func StreamUpdate(r io.Reader, w io.Writer, handler func(path string, value *yaml.Node) *yaml.Node, opts ...Option) error {
+	options := newOptions(opts)
+
+	// Detect the indentation from what fits in the read buffer; Peek returns
+	// what it has when the stream is shorter
+	br := bufio.NewReaderSize(r, streamPeekSize)
+	head, err := br.Peek(streamPeekSize)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return fmt.Errorf("failed to read YAML: %w", err)
+	}
+
+	dec := yaml.NewDecoder(br)
+	indent := options.indentation(head)
+
+	for first := true; ; first = false {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("failed to parse YAML: %w", err)
+		}
+		streamScalars(&doc, nil, handler)
+
+		// A yaml.Encoder keeps every event it has emitted, so each document
+		// gets a fresh one and the separators are written here
+		out, err := encodeDocument(&doc, indent)
+		if err != nil {
+			return err
+		}
+		if !first {
+			out = append([]byte("---\n"), out...)
+		}
+		if _, err := w.Write(out); err != nil {
+			return fmt.Errorf("failed to write YAML: %w", err)
+		}
+	}
+}
+
+// streamScalars calls handler for every scalar below node and returns the
+// node to keep in its place. Aliases are not followed, so anchored values are
+// only seen where they are defined.
+func streamScalars(node *yaml.Node, path []pathSegment, handler func(path string, value *yaml.Node) *yaml.Node) *yaml.Node {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for i, child := range node.Content {
+			node.Content[i] = streamScalars(child, path, handler)
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			node.Content[i] = streamScalars(child, append(path, pathSegment{index: i, isIndex: true}), handler)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].ShortTag() == "!!merge" {
+				continue
+			}
+			segment := pathSegment{key: keyValue(node.Content[i])}
+			node.Content[i+1] = streamScalars(node.Content[i+1], append(path, segment), handler)
+		}
+	case yaml.ScalarNode:
+		if replacement := handler(formatPath(path), node); replacement != nil {
+			if replacement.HeadComment == "" && replacement.LineComment == "" && replacement.FootComment == "" {
+				replacement.HeadComment = node.HeadComment
+				replacement.LineComment = node.LineComment
+				replacement.FootComment = node.FootComment
+			}
+			return replacement
+		}
+	}
+	return node
+}
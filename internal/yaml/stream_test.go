@@ -0,0 +1,131 @@
+package yaml
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestStreamUpdate(t *testing.T) {
+	upper := func(path string, value *yaml.Node) *yaml.Node {
+		if path != "spec.image" {
+			return nil
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: strings.ToUpper(value.Value)}
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		opts    []Option
+		want    string
+	}{
+		{
+			name:    "rewrite across documents",
+			content: "spec:\n  image: a # pinned\n---\nspec:\n  image: b\n  port: 80\n",
+			want:    "spec:\n  image: A # pinned\n---\nspec:\n  image: B\n  port: 80\n",
+		},
+		{
+			name:    "detected indentation",
+			content: "spec:\n    image: a\n    ports:\n        - 80\n",
+			want:    "spec:\n    image: A\n    ports:\n        - 80\n",
+		},
+		{
+			name:    "forced indentation",
+			content: "spec:\n    image: a\n",
+			opts:    []Option{WithIndent(2)},
+			want:    "spec:\n  image: A\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := StreamUpdate(strings.NewReader(tt.content), &out, upper, tt.opts...); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+// documentStream generates count YAML documents on demand so the input never
+// has to be held in memory.
+type documentStream struct {
+	count, next int
+	buf         bytes.Buffer
+}
+
+func (s *documentStream) Read(p []byte) (int, error) {
+	for s.buf.Len() < len(p) && s.next < s.count {
+		fmt.Fprintf(&s.buf, "---\nid: %d\nname: service-%d\n", s.next, s.next)
+		for i := 0; i < 20; i++ {
+			fmt.Fprintf(&s.buf, "setting%d: value %d of document %d\n", i, i, s.next)
+		}
+		s.next++
+	}
+	if s.buf.Len() == 0 {
+		return 0, io.EOF
+	}
+	return s.buf.Read(p)
+}
+
+// countingWriter counts the bytes written and whether want was among them.
+type countingWriter struct {
+	n     int64
+	want  []byte
+	found bool
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	w.found = w.found || bytes.Contains(p, w.want)
+	return len(p), nil
+}
+
+func TestStreamUpdateBoundedMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("large stream")
+	}
+	const documents = 24000
+	const limit = 8 << 20
+
+	var peak uint64
+	var stats runtime.MemStats
+	calls := 0
+	handler := func(path string, value *yaml.Node) *yaml.Node {
+		calls++
+		if calls%5000 == 0 {
+			runtime.GC()
+			runtime.ReadMemStats(&stats)
+			if stats.HeapAlloc > peak {
+				peak = stats.HeapAlloc
+			}
+		}
+		if path == "name" && value.Value == "service-12345" {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "renamed-service"}
+		}
+		return nil
+	}
+
+	out := &countingWriter{want: []byte("name: renamed-service\n")}
+	if err := StreamUpdate(&documentStream{count: documents}, out, handler); err != nil {
+		t.Fatal(err)
+	}
+	if !out.found {
+		t.Error("rewritten value not found in the output")
+	}
+	if out.n < 2*limit {
+		t.Fatalf("stream of %d bytes is too small to show bounded memory", out.n)
+	}
+	if peak > limit {
+		t.Errorf("heap reached %d bytes streaming %d bytes, want at most %d", peak, out.n, limit)
+	}
+}
@@ -0,0 +1,34 @@
+package yaml
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// substitutionToken matches a ${name} placeholder in a string value.
+var substitutionToken = regexp.MustCompile(`\$\{([^${}]+)\}`)
+
+// substitute replaces the ${name} tokens of s with their Options.Substitutions
+// values. Unknown tokens are kept as they are, or reported with
+// ErrUnknownSubstitution under Options.FailOnUnknownSubstitution.
+func (u *updater) substitute(s string) (string, error) {
+	if u.opts.Substitutions == nil && !u.opts.FailOnUnknownSubstitution {
+		return s, nil
+	}
+
+	var unknown string
+	out := substitutionToken.ReplaceAllStringFunc(s, func(token string) string {
+		name := substitutionToken.FindStringSubmatch(token)[1]
+		if value, ok := u.opts.Substitutions[name]; ok {
+			return value
+		}
+		if unknown == "" {
+			unknown = name
+		}
+		return token
+	})
+	if unknown != "" && u.opts.FailOnUnknownSubstitution {
+		return "", fmt.Errorf("%w: ${%s} at %s", ErrUnknownSubstitution, unknown, u.currentPath())
+	}
+	return out, nil
+}
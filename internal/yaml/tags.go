@@ -0,0 +1,65 @@
+package yaml
+
+import (
+	"reflect"
+	"strings"
+)
+
+// fieldTag is the parsed form of a `yaml:"name,opt1,opt2"` struct tag, or of
+// the tag named by Options.TagName.
+type fieldTag struct {
+	name string
+
+	// skip is set for the `yaml:"-"` tag; the field is ignored entirely
+	skip bool
+
+	// anchor uses the field's string value as the anchor name of the mapping holding it
+	anchor bool
+	// inline spreads a map field's entries into the mapping holding it
+	inline bool
+	// omitempty leaves out empty values and removes their existing key
+	omitempty bool
+	// immutable writes the field only when its key is missing from the document
+	immutable bool
+}
+
+// parseFieldTag reads the tagName tag of field, e.g. yaml, falling back to the
+// field name when the tag has no name.
+func parseFieldTag(field reflect.StructField, tagName string) fieldTag {
+	raw := field.Tag.Get(tagName)
+	if raw == "-" {
+		return fieldTag{name: "-", skip: true}
+	}
+	parts := strings.Split(raw, ",")
+
+	tag := fieldTag{name: parts[0]}
+	if tag.name == "" {
+		tag.name = field.Name
+	}
+	for _, opt := range parts[1:] {
+		switch opt {
+		case "anchor":
+			tag.anchor = true
+		case "inline":
+			tag.inline = true
+		case "omitempty":
+			tag.omitempty = true
+		case "immutable":
+			tag.immutable = true
+		}
+	}
+	return tag
+}
+
+// isEmptyValue reports whether v is empty for the omitempty option: false, 0,
+// "", a nil pointer or interface, an empty slice, map or array, or a zero struct.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	default:
+		return v.IsZero()
+	}
+}
@@ -0,0 +1,120 @@
+package yaml
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// templateExpr matches a single-line Go/Helm template action such as {{ .Values.x }}.
+var templateExpr = regexp.MustCompile(`\{\{.*?\}\}`)
+
+// templateMask records the template actions replaced by placeholders so they
+// can be restored verbatim after encoding.
+type templateMask struct {
+	prefix       string
+	placeholders [][]byte
+	originals    [][]byte
+	// lines marks placeholders standing for a whole action-only line; their
+	// originals hold the full line, indentation included.
+	lines []bool
+}
+
+// maskTemplates replaces every {{...}} action in content with an opaque plain
+// scalar placeholder. Lines consisting only of actions (e.g. {{- if .x }}) are
+// turned into comments so they survive parsing as well.
+func maskTemplates(content []byte) ([]byte, *templateMask) {
+	mask := &templateMask{prefix: "__yammy_tpl_"}
+	for bytes.Contains(content, []byte(mask.prefix)) {
+		mask.prefix = "_" + mask.prefix
+	}
+
+	lines := bytes.Split(content, []byte("\n"))
+	for i, line := range lines {
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) == 0 || !templateExpr.Match(trimmed) {
+			continue
+		}
+
+		if len(templateExpr.ReplaceAll(trimmed, nil)) == 0 {
+			indent := line[:len(line)-len(bytes.TrimLeft(line, " \t"))]
+			placeholder := mask.add(line, "# ", true)
+			lines[i] = append(append([]byte{}, indent...), placeholder...)
+			continue
+		}
+
+		lines[i] = mask.maskActions(line)
+	}
+
+	return bytes.Join(lines, []byte("\n")), mask
+}
+
+// maskActions replaces the template actions in text with placeholders.
+func (m *templateMask) maskActions(text []byte) []byte {
+	return templateExpr.ReplaceAllFunc(text, func(expr []byte) []byte {
+		return m.add(expr, "", false)
+	})
+}
+
+func (m *templateMask) add(original []byte, lead string, line bool) []byte {
+	placeholder := []byte(fmt.Sprintf("%s%s%d__", lead, m.prefix, len(m.placeholders)))
+	m.placeholders = append(m.placeholders, placeholder)
+	m.originals = append(m.originals, append([]byte{}, original...))
+	m.lines = append(m.lines, line)
+	return placeholder
+}
+
+// maskNode masks the template actions in scalar values written during the
+// update, so the encoder sees plain text and keeps the style the value was
+// given instead of quoting it for its braces.
+func (m *templateMask) maskNode(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode && templateExpr.MatchString(node.Value) {
+		node.Value = string(m.maskActions([]byte(node.Value)))
+	}
+	for _, child := range node.Content {
+		m.maskNode(child)
+	}
+}
+
+// unmaskNode puts the original template actions back into the scalar values
+// below node.
+func (m *templateMask) unmaskNode(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode && strings.Contains(node.Value, m.prefix) {
+		node.Value = string(m.unmask([]byte(node.Value)))
+	}
+	for _, child := range node.Content {
+		m.unmaskNode(child)
+	}
+}
+
+// unmask puts the original template actions back in place of their
+// placeholders. Action-only lines are restored whole, at the column they were
+// read from, whatever indentation the encoder gave their comment.
+func (m *templateMask) unmask(content []byte) []byte {
+	lines := bytes.Split(content, []byte("\n"))
+	for i, line := range lines {
+		trimmed := bytes.TrimSpace(line)
+		if !bytes.HasPrefix(trimmed, []byte("# "+m.prefix)) {
+			continue
+		}
+		for j, placeholder := range m.placeholders {
+			if m.lines[j] && bytes.Equal(trimmed, placeholder) {
+				lines[i] = m.originals[j]
+				break
+			}
+		}
+	}
+	content = bytes.Join(lines, []byte("\n"))
+
+	for i := range m.placeholders {
+		original := m.originals[i]
+		if m.lines[i] {
+			original = bytes.TrimSpace(original)
+		}
+		content = bytes.ReplaceAll(content, m.placeholders[i], original)
+	}
+	return content
+}
@@ -0,0 +1,56 @@
+package yaml
+
+import "testing"
+
+func TestPreserveTemplates(t *testing.T) {
+	type spec struct {
+		Replicas int `yaml:"replicas"`
+	}
+	type values struct {
+		Spec spec `yaml:"spec"`
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		data    interface{}
+		want    string
+	}{
+		{
+			name:    "helm if block around a sequence",
+			content: "image: {{ .Values.image }}\nports:\n{{- if .Values.http }}\n  - 80\n{{- end }}\n  - 443\nname: app\n",
+			data:    map[string]interface{}{"name": "web"},
+			want:    "image: {{ .Values.image }}\nports:\n{{- if .Values.http }}\n  - 80\n{{- end }}\n  - 443\nname: web\n",
+		},
+		{
+			name:    "indented action line",
+			content: "spec:\n  {{- with .Values.extra }}\n  extra: {{ . }}\n  {{- end }}\n  replicas: 1\n",
+			data:    values{Spec: spec{Replicas: 3}},
+			want:    "spec:\n  {{- with .Values.extra }}\n  extra: {{ . }}\n  {{- end }}\n  replicas: 3\n",
+		},
+		{
+			name:    "templated value written into a plain scalar",
+			content: "repo: {{ .Values.repo }}/app\n",
+			data:    map[string]interface{}{"repo": "{{ .Values.other }}/app"},
+			want:    "repo: {{ .Values.other }}/app\n",
+		},
+		{
+			name:    "templated value written into a quoted scalar",
+			content: "name: '{{ .Release.Name }}'\n",
+			data:    map[string]interface{}{"name": "{{ .Chart.Name }}"},
+			want:    "name: '{{ .Chart.Name }}'\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAMLWithOptions([]byte(tt.content), tt.data, Options{PreserveTemplates: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", out, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package yaml
+
+import (
+	"fmt"
+	"strings"
+)
+
+// unifiedContext is the number of unchanged lines shown around each change.
+const unifiedContext = 3
+
+// UnifiedDiff updates original with data and returns a unified diff between
+// the original and updated text, suitable for previews in reviews.
+// An empty string means the update changes nothing. opts tune the update as
+// for UpdateYAML.
+func UnifiedDiff(original []byte, data interface{}, opts ...Option) (string, error) {
+	updated, err := UpdateYAML(original, data, opts...)
+	if err != nil {
+		return "", err
+	}
+	return unifiedDiff(splitLines(string(original)), splitLines(string(updated))), nil
+}
+
+// diffLine is one line of an edit script: ' ' unchanged, '-' removed, '+' added.
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// splitLines splits text into lines, without a trailing empty line for a final newline.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// editScript computes a line-level edit script from a to b using the longest
+// common subsequence. Common prefix and suffix are peeled off first, which
+// keeps the quadratic part small for typical config edits.
+func editScript(a, b []string) []diffLine {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var script []diffLine
+	for _, line := range a[:prefix] {
+		script = append(script, diffLine{' ', line})
+	}
+
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	lcs := make([][]int, len(ma)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(mb)+1)
+	}
+	for i := len(ma) - 1; i >= 0; i-- {
+		for j := len(mb) - 1; j >= 0; j-- {
+			if ma[i] == mb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(ma) || j < len(mb) {
+		switch {
+		case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+			script = append(script, diffLine{' ', ma[i]})
+			i++
+			j++
+		case i < len(ma) && (j == len(mb) || lcs[i+1][j] >= lcs[i][j+1]):
+			script = append(script, diffLine{'-', ma[i]})
+			i++
+		default:
+			script = append(script, diffLine{'+', mb[j]})
+			j++
+		}
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		script = append(script, diffLine{' ', line})
+	}
+	return script
+}
+
+// unifiedDiff renders the edit script from a to b in unified diff format.
+func unifiedDiff(a, b []string) string {
+	script := editScript(a, b)
+
+	var sb strings.Builder
+	for start := 0; start < len(script); {
+		// Find the next change
+		for start < len(script) && script[start].op == ' ' {
+			start++
+		}
+		if start == len(script) {
+			break
+		}
+
+		// Extend the hunk while changes are close enough to share context
+		end := start
+		for k := start; k < len(script); k++ {
+			if script[k].op != ' ' {
+				end = k + 1
+			} else if k-end >= 2*unifiedContext {
+				break
+			}
+		}
+
+		from := max(start-unifiedContext, 0)
+		to := min(end+unifiedContext, len(script))
+
+		if sb.Len() == 0 {
+			sb.WriteString("--- original\n+++ updated\n")
+		}
+		aStart, bStart := lineNumbers(script, from)
+		aCount, bCount := 0, 0
+		for _, line := range script[from:to] {
+			if line.op != '+' {
+				aCount++
+			}
+			if line.op != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+		for _, line := range script[from:to] {
+			sb.WriteByte(line.op)
+			sb.WriteString(line.text)
+			sb.WriteByte('\n')
+		}
+
+		start = to
+	}
+	return sb.String()
+}
+
+// lineNumbers returns the 1-based line numbers in a and b at script position pos.
+func lineNumbers(script []diffLine, pos int) (int, int) {
+	a, b := 1, 1
+	for _, line := range script[:pos] {
+		if line.op != '+' {
+			a++
+		}
+		if line.op != '-' {
+			b++
+		}
+	}
+	return a, b
+}
+
+// hunkRange formats a hunk range; an empty range refers to the line before it.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
@@ -0,0 +1,56 @@
+package yaml
+
+import "testing"
+
+func TestUnifiedDiff(t *testing.T) {
+	content, person := readTestPerson(t)
+	older := person
+	older.Age = 31
+
+	tests := []struct {
+		name    string
+		content []byte
+		data    interface{}
+		opts    []Option
+		want    string
+	}{
+		{
+			name:    "changed age",
+			content: content,
+			data:    older,
+			want: "--- original\n+++ updated\n@@ -1,6 +1,6 @@\n" +
+				" # This is a comment for the document\n" +
+				" name: John # Inline comment for the name\n" +
+				"-age: 30\n" +
+				"+age: 31\n" +
+				" hobbies: # List of hobbies\n" +
+				"   - reading # Main hobby\n" +
+				"   - gaming\n",
+		},
+		{
+			name:    "no change",
+			content: content,
+			data:    person,
+			want:    "",
+		},
+		{
+			name:    "options",
+			content: []byte("a: 1\nb:\n  c: 2\n"),
+			data:    map[string]interface{}{"b": map[string]interface{}{"c": 2, "d": 3}},
+			opts:    []Option{WithIndent(4)},
+			want:    "--- original\n+++ updated\n@@ -1,3 +1,4 @@\n a: 1\n b:\n-  c: 2\n+    c: 2\n+    d: 3\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff, err := UnifiedDiff(tt.content, tt.data, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", diff, tt.want)
+			}
+		})
+	}
+}
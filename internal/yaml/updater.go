@@ -0,0 +1,59 @@
+package yaml
+
+// updater carries the options and the current position of a single update
+// through the node traversal.
+type updater struct {
+	opts Options
+	path []pathSegment
+
+	// fillOnly restricts the update to keys missing from the document
+	fillOnly bool
+	// collectMissing records absent keys in missing instead of adding them
+	collectMissing bool
+	missing        []string
+
+	// pruned collects the paths of the keys removed by PruneUnknownKeys
+	pruned []string
+
+	// regions are the line ranges of Options.ManagedRegion in the content
+	regions [][2]int
+
+	// changes counts the scalars written with a new value
+	changes int
+}
+
+func newUpdater(opts Options) *updater {
+	return &updater{opts: opts}
+}
+
+// enter pushes a mapping key onto the current path.
+func (u *updater) enter(key string) {
+	u.path = append(u.path, pathSegment{key: key})
+}
+
+// enterIndex pushes a sequence index onto the current path.
+func (u *updater) enterIndex(index int) {
+	u.path = append(u.path, pathSegment{index: index, isIndex: true})
+}
+
+// leave pops the last segment pushed by enter or enterIndex.
+func (u *updater) leave() {
+	u.path = u.path[:len(u.path)-1]
+}
+
+// debug logs msg with the current path to Options.Logger at debug level.
+func (u *updater) debug(msg string, args ...any) {
+	if u.opts.Logger == nil {
+		return
+	}
+	u.opts.Logger.Debug(msg, append([]any{"path", u.currentPath()}, args...)...)
+}
+
+// currentPath renders the current position as a dotted path, e.g.
+// "skills.programming[0].level", in the form parsePath reads back.
+func (u *updater) currentPath() string {
+	if len(u.path) == 0 {
+		return "<root>"
+	}
+	return formatPath(u.path)
+}
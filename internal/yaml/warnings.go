@@ -0,0 +1,144 @@
+package yaml
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Result is the outcome of an update together with the formatting details the
+// encoder could not reproduce.
+type Result struct {
+	Content  []byte
+	Warnings []string
+}
+
+// logWarnings sends the warnings of result to Options.Logger at warn level.
+func logWarnings(result *Result, opts Options) {
+	if opts.Logger == nil {
+		return
+	}
+	for _, warning := range result.Warnings {
+		opts.Logger.Warn(warning)
+	}
+}
+
+var (
+	// flowSpacing matches spacing the encoder does not reproduce in a flow collection
+	flowSpacing = regexp.MustCompile(`[\[{]\s|\s[\]}]|\s,|,\S|,\s{2,}|:\s{2,}`)
+	// alignedComment matches a trailing comment preceded by more than one space
+	alignedComment = regexp.MustCompile(`\S\s{2,}#`)
+)
+
+// collectWarnings describes the known-lossy transformations encoding root will
+// perform on the original content: re-spaced flow collections, realigned
+// trailing comments, dropped directives and document start markers.
+func collectWarnings(content []byte, root *yaml.Node) []string {
+	lines := bytes.Split(content, []byte("\n"))
+
+	var warnings []string
+	for i, line := range lines {
+		switch {
+		case bytes.HasPrefix(line, []byte("%")):
+			warnings = append(warnings, fmt.Sprintf("directive dropped at line %d", i+1))
+		case bytes.Equal(bytes.TrimRight(line, " \t\r"), []byte("---")) && i == firstContentLine(lines):
+			warnings = append(warnings, fmt.Sprintf("document start marker dropped at line %d", i+1))
+		}
+	}
+
+	var walk func(node *yaml.Node)
+	walk = func(node *yaml.Node) {
+		if node.Line > 0 && node.Line <= len(lines) {
+			line := lines[node.Line-1]
+			if node.Style&yaml.FlowStyle != 0 && (node.Kind == yaml.SequenceNode || node.Kind == yaml.MappingNode) {
+				if segment, ok := flowSegment(line, node.Column-1); ok && flowSpacing.Match(segment) {
+					warnings = append(warnings, fmt.Sprintf("flow %s re-spaced at line %d", kindName(node.Kind), node.Line))
+				}
+				// Children share the line and are re-spaced with their parent
+				return
+			}
+			if node.LineComment != "" && alignedComment.Match(line) {
+				warnings = append(warnings, fmt.Sprintf("comment alignment changed at line %d", node.Line))
+			}
+		}
+		for _, child := range node.Content {
+			walk(child)
+		}
+	}
+	walk(root)
+
+	return warnings
+}
+
+// extraDocuments returns how many documents follow the first one in content
+// and the line the first of them starts on. Only the first document is
+// updated, the rest would be dropped from the output.
+func extraDocuments(content []byte) (count, line int) {
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	for i := 0; ; i++ {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return count, line
+		}
+		if i == 0 {
+			if err != nil {
+				return 0, 0
+			}
+			continue
+		}
+		count++
+		if count == 1 {
+			line = doc.Line
+		}
+		if err != nil {
+			// The decoder cannot resume after an error
+			return count, line
+		}
+	}
+}
+
+// firstContentLine returns the index of the first line that is not blank, a
+// comment or a directive.
+func firstContentLine(lines [][]byte) int {
+	for i, line := range lines {
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) > 0 && trimmed[0] != '#' && trimmed[0] != '%' {
+			return i
+		}
+	}
+	return -1
+}
+
+// flowSegment returns the text of the single-line flow collection starting at
+// column start of line, up to its matching closing bracket.
+func flowSegment(line []byte, start int) ([]byte, bool) {
+	if start < 0 || start >= len(line) {
+		return nil, false
+	}
+
+	depth := 0
+	for i := start; i < len(line); i++ {
+		switch line[i] {
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+			if depth == 0 {
+				return line[start : i+1], true
+			}
+		}
+	}
+	return nil, false
+}
+
+func kindName(kind yaml.Kind) string {
+	if kind == yaml.MappingNode {
+		return "mapping"
+	}
+	return "sequence"
+}
@@ -0,0 +1,143 @@
+package yaml
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpdateYAMLExtraDocuments(t *testing.T) {
+	content := []byte("a: 1\n---\nb: 2\n")
+	data := map[string]int{"a": 2}
+
+	if _, err := UpdateYAML(content, data, WithStrict()); !errors.Is(err, ErrExtraDocuments) {
+		t.Errorf("strict update: got error %v, want ErrExtraDocuments", err)
+	}
+
+	result, err := UpdateYAMLResult(content, data, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result.Content) != "a: 2\n" {
+		t.Errorf("got %q, want only the first document", result.Content)
+	}
+	if want := "1 extra document(s) dropped starting at line 2"; !containsString(result.Warnings, want) {
+		t.Errorf("warnings %q do not contain %q", result.Warnings, want)
+	}
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	if _, err := UpdateYAML(content, data, WithLogger(logger)); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "level=WARN") || !strings.Contains(logs.String(), "extra document(s) dropped") {
+		t.Errorf("UpdateYAML logged no warning:\n%s", logs.String())
+	}
+}
+
+func TestEntryPointsLogWarnings(t *testing.T) {
+	content := []byte("a: 1\n---\nb: 2\n")
+	data := map[string]int{"a": 2}
+
+	tests := []struct {
+		name   string
+		update func(logger *slog.Logger) error
+	}{
+		{
+			name: "UpdateYAMLWithOptions",
+			update: func(logger *slog.Logger) error {
+				_, err := UpdateYAMLWithOptions(content, data, Options{Logger: logger})
+				return err
+			},
+		},
+		{
+			name: "UpdateYAMLFile",
+			update: func(logger *slog.Logger) error {
+				path := filepath.Join(t.TempDir(), "config.yaml")
+				if err := os.WriteFile(path, content, 0o644); err != nil {
+					return err
+				}
+				return UpdateYAMLFile(path, data, WithLogger(logger))
+			},
+		},
+		{
+			name: "UpdateAndMarshalJSON",
+			update: func(logger *slog.Logger) error {
+				_, _, err := UpdateAndMarshalJSON(content, data, WithLogger(logger))
+				return err
+			},
+		},
+		{
+			name: "FillDefaults",
+			update: func(logger *slog.Logger) error {
+				_, err := FillDefaults(content, data, WithLogger(logger))
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			if err := tt.update(slog.New(slog.NewTextHandler(&logs, nil))); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(logs.String(), "level=WARN") || !strings.Contains(logs.String(), "extra document(s) dropped") {
+				t.Errorf("logged no warning:\n%s", logs.String())
+			}
+		})
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestUpdateYAMLResultWarnings(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "flow spacing normalized",
+			content: "a: [ 1, 2 ]\nb: {x:  1}\n",
+			want:    []string{"flow sequence re-spaced at line 1", "flow mapping re-spaced at line 2"},
+		},
+		{
+			name:    "aligned comment",
+			content: "a: 1   # note\n",
+			want:    []string{"comment alignment changed at line 1"},
+		},
+		{
+			name:    "directive and start marker",
+			content: "%TAG !e! tag:example.com,2000:\n---\na: 1\n",
+			want:    []string{"directive dropped at line 1", "document start marker dropped at line 2"},
+		},
+		{
+			name:    "nothing lost",
+			content: "a: [1, 2]\nb: 1 # note\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := UpdateYAMLResult([]byte(tt.content), map[string]int{"a": 1}, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(result.Warnings, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got warnings %q, want %q", result.Warnings, tt.want)
+			}
+		})
+	}
+}
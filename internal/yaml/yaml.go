@@ -2,66 +2,521 @@ package yaml
 
 import (
 	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
 
 	"gopkg.in/yaml.v3"
 )
 
+// utf8BOM is the byte order mark some Windows editors put at the start of UTF-8 files
+var utf8BOM = []byte("\xef\xbb\xbf")
+
 // UpdateYAML reads a YAML content, updates it with new data while preserving formatting,
-// and returns the updated YAML content
-func UpdateYAML(content []byte, newData interface{}) ([]byte, error) {
-	indent := detectIndentation(string(content))
+// and returns the updated YAML content. The root mapping keeps its style, so a
+// flow-style document such as {a: 1, b: 2} stays on one line. Updating is
+// idempotent: applying the same data to the output again returns it unchanged.
+// It is also deterministic: map entries are visited in sorted key order, so
+// the same content and data always produce byte-identical output.
+// Only the first document of content is updated and written back; WithStrict
+// makes the update fail on further ones, which are otherwise reported like
+// the other warnings of UpdateYAMLResult to the logger set by WithLogger.
+// opts tune the update, e.g. WithIndent or WithPruneUnknownKeys.
+func UpdateYAML(content []byte, newData interface{}, opts ...Option) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := UpdateYAMLTo(&buf, content, newData, opts...); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
 
-	var root yaml.Node
-	if err := yaml.Unmarshal(content, &root); err != nil {
+// UpdateYAMLTo behaves like UpdateYAML but writes the updated content to w.
+// Nothing is written if the update fails. The document is still assembled in
+// memory first, as restoring the layout works on the encoded text.
+func UpdateYAMLTo(w io.Writer, content []byte, newData interface{}, opts ...Option) error {
+	out, err := UpdateYAMLWithOptions(content, newData, newOptions(opts))
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(out); err != nil {
+		return fmt.Errorf("failed to write YAML: %w", err)
+	}
+	return nil
+}
+
+// UpdateYAMLFrom behaves like UpdateYAML but reads the content from r. The
+// stream is read to the end before anything else, so the layout is detected
+// on the whole document however r hands it out.
+func UpdateYAMLFrom(r io.Reader, newData interface{}, opts ...Option) ([]byte, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read YAML: %w", err)
+	}
+	return UpdateYAML(content, newData, opts...)
+}
+
+// UpdateYAMLWithOptions behaves like UpdateYAML but lets the caller tune the update through opts
+func UpdateYAMLWithOptions(content []byte, newData interface{}, opts Options) ([]byte, error) {
+	result, err := UpdateYAMLResult(content, newData, opts)
+	if err != nil {
+		return nil, err
+	}
+	logWarnings(result, opts)
+	return result.Content, nil
+}
+
+// UpdateYAMLSafe behaves like UpdateYAML but returns content unchanged along
+// with the error when the update fails, e.g. on malformed input, so callers
+// processing many files can log and move on without losing data.
+func UpdateYAMLSafe(content []byte, newData interface{}, opts ...Option) ([]byte, error) {
+	out, err := UpdateYAML(content, newData, opts...)
+	if err != nil {
+		return content, err
+	}
+	return out, nil
+}
+
+// UpdateYAMLResult behaves like UpdateYAMLWithOptions and also reports the
+// formatting that could not be preserved in the returned Result's Warnings
+func UpdateYAMLResult(content []byte, newData interface{}, opts Options) (*Result, error) {
+	return newUpdater(opts).updateDocument(content, newData)
+}
+
+// parsedDocument is content parsed the way every update reads it, along with
+// the layout details that have to be put back when it is encoded again.
+type parsedDocument struct {
+	root yaml.Node
+	// content is the text that was parsed: without BOM or checksum, with
+	// tabs expanded and template actions masked
+	content      []byte
+	indent       int
+	hasBOM       bool
+	templates    *templateMask
+	seqIndent    int
+	hasSeqIndent bool
+	blankLines   *blankLineMarks
+	warnings     []string
+}
+
+// parseDocument parses content for an update with opts.
+func parseDocument(content []byte, opts Options) (*parsedDocument, error) {
+	doc := &parsedDocument{}
+
+	// Parse without a UTF-8 byte order mark and put it back on output so the
+	// file's bytes only change where the data did
+	doc.hasBOM = bytes.HasPrefix(content, utf8BOM)
+	content = bytes.TrimPrefix(content, utf8BOM)
+	if opts.AppendChecksum {
+		content = stripChecksum(content)
+	}
+	if opts.NormalizeTabs {
+		content = expandLeadingTabs(content, opts.indentation(content))
+	}
+
+	if opts.PreserveTemplates {
+		content, doc.templates = maskTemplates(content)
+	}
+
+	doc.content = content
+	doc.indent = opts.indentation(content)
+
+	if err := yaml.Unmarshal(content, &doc.root); err != nil {
+		if line := tabIndentedLine(content); line > 0 {
+			return nil, fmt.Errorf("%w: line %d is indented with a tab (see Options.NormalizeTabs): %v", ErrTabIndentation, line, err)
+		}
 		return nil, fmt.Errorf("failed to parse YAML: %w", err)
 	}
+	if doc.root.Kind == 0 {
+		doc.root = *emptyDocument(content)
+	}
+	doc.warnings = collectWarnings(content, &doc.root)
+	if count, line := extraDocuments(content); count > 0 {
+		where := ""
+		if line > 0 {
+			where = fmt.Sprintf(" starting at line %d", line)
+		}
+		if opts.Strict {
+			return nil, fmt.Errorf("%w: %d after the first one%s", ErrExtraDocuments, count, where)
+		}
+		doc.warnings = append(doc.warnings, fmt.Sprintf("%d extra document(s) dropped%s", count, where))
+	}
+	doc.seqIndent, doc.hasSeqIndent = detectSequenceIndent(&doc.root)
+	doc.blankLines = markBlankLines(content, &doc.root)
+	return doc, nil
+}
+
+// updateDocument parses content, applies newData and encodes the result.
+func (u *updater) updateDocument(content []byte, newData interface{}) (*Result, error) {
+	doc, err := parseDocument(content, u.opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.update(doc, newData); err != nil {
+		return nil, err
+	}
+
+	root := &doc.root
+	if err := applyPathStyles(root, u.opts.FlowStylePaths, u.opts.BlockStylePaths); err != nil {
+		return nil, err
+	}
+	if u.opts.OnKey != nil {
+		walkPairs(root, nil, u.opts.OnKey)
+	}
+
+	if u.opts.SortKeys || len(u.opts.PinnedKeys) > 0 {
+		sortDocumentKeys(root, u.opts.PinnedKeys)
+	}
+	if u.opts.HeaderComment != "" {
+		setHeaderComment(root, u.opts.HeaderComment, u.opts.ReplaceHeader)
+	}
+
+	out, err := doc.encode(u.opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Content: out, Warnings: doc.warnings}, nil
+}
+
+// update applies newData to the tree of doc.
+func (u *updater) update(doc *parsedDocument, newData interface{}) error {
+	if u.opts.ManagedRegion != [2]string{} {
+		u.regions = managedRegions(doc.content, u.opts.ManagedRegion)
+	}
+
+	if err := u.updateYamlFromStruct(&doc.root, newData); err != nil {
+		return fmt.Errorf("failed to update YAML: %w", err)
+	}
+	if u.opts.MaxChanges > 0 && u.changes > u.opts.MaxChanges {
+		return fmt.Errorf("%w: %d changes, at most %d allowed", ErrTooManyChanges, u.changes, u.opts.MaxChanges)
+	}
+	return nil
+}
+
+// encode encodes the tree of doc and restores the layout parseDocument took
+// apart: blank lines, sequence indentation, templates and the BOM.
+func (doc *parsedDocument) encode(opts Options) ([]byte, error) {
+	if doc.templates != nil {
+		doc.templates.maskNode(&doc.root)
+	}
+
+	out, err := encodeDocument(&doc.root, doc.indent)
+	if err != nil {
+		return nil, err
+	}
+	if doc.blankLines != nil {
+		out = doc.blankLines.restore(out)
+	}
+	if doc.hasSeqIndent {
+		out = reindentSequences(out, doc.seqIndent)
+	}
+	out = shiftColumns(out, opts.RootColumn)
+
+	if doc.templates != nil {
+		out = doc.templates.unmask(out)
+	}
+	if doc.hasBOM {
+		out = append(append([]byte{}, utf8BOM...), out...)
+	}
+	if opts.AppendChecksum {
+		out = appendChecksum(out)
+	}
+	if opts.VerifyOutput {
+		if err := doc.verify(out, opts); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
 
-	if err := updateYamlFromStruct(&root, newData); err != nil {
-		return nil, fmt.Errorf("failed to update YAML: %w", err)
+// applyPathStyles switches the collections at the flow paths to flow style and
+// those at the block paths to block style. Paths missing from the document are
+// skipped so one set of options can be applied to many files.
+func applyPathStyles(root *yaml.Node, flowPaths, blockPaths []string) error {
+	apply := func(paths []string, flow bool) error {
+		for _, path := range paths {
+			segments, err := parsePath(path)
+			if err != nil {
+				return err
+			}
+			node, err := lookupPath(documentBody(root), segments)
+			if errors.Is(err, ErrPathNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if node.Kind != yaml.SequenceNode && node.Kind != yaml.MappingNode {
+				continue
+			}
+			if flow {
+				node.Style |= yaml.FlowStyle
+			} else {
+				node.Style &^= yaml.FlowStyle
+			}
+		}
+		return nil
 	}
 
+	if err := apply(flowPaths, true); err != nil {
+		return err
+	}
+	return apply(blockPaths, false)
+}
+
+// setHeaderComment puts header at the top of the document, commenting out
+// lines that are not comments yet. An existing header is kept below it unless
+// replace is set or it already starts with header. yaml.v3 attaches a header
+// that directly precedes the first key to that key, so when replacing, the
+// first key's head comment counts as the header if the document has no other,
+// and so does the part of it above a blank line.
+func setHeaderComment(root *yaml.Node, header string, replace bool) {
+	lines := strings.Split(strings.TrimRight(header, "\n"), "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "#") {
+			lines[i] = strings.TrimRight("# "+line, " ")
+		}
+	}
+	header = strings.Join(lines, "\n")
+
+	existing := root.HeadComment
+	switch {
+	case replace:
+		if first := firstKey(root); first != nil {
+			if i := strings.LastIndex(first.HeadComment, "\n\n"); i >= 0 {
+				first.HeadComment = first.HeadComment[i+2:]
+			} else if existing == "" {
+				first.HeadComment = ""
+			}
+		}
+		root.HeadComment = header
+	case existing == "":
+		root.HeadComment = header
+	case !strings.HasPrefix(existing, header):
+		root.HeadComment = header + "\n\n" + existing
+	}
+}
+
+// firstKey returns the first key of the mapping a document holds, or nil.
+func firstKey(root *yaml.Node) *yaml.Node {
+	body := documentBody(root)
+	if body.Kind != yaml.MappingNode || len(body.Content) == 0 {
+		return nil
+	}
+	return body.Content[0]
+}
+
+// emptyDocument returns the document for content holding no node: an empty
+// mapping below the comments content may have, which yaml.v3 drops when a
+// document holds nothing else.
+func emptyDocument(content []byte) *yaml.Node {
+	doc := &yaml.Node{
+		Kind:    yaml.DocumentNode,
+		Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}},
+	}
+	if comments := strings.TrimSpace(string(content)); comments != "" {
+		doc.HeadComment = comments
+	}
+	return doc
+}
+
+func encodeDocument(root *yaml.Node, indent int) ([]byte, error) {
 	root.Column = 0
 	if len(root.Content) > 0 {
 		root.Content[0].Column = 0
 	}
+	renameAliases(root)
 
 	var buf bytes.Buffer
 	enc := yaml.NewEncoder(&buf)
 	enc.SetIndent(indent)
-	if err := enc.Encode(&root); err != nil {
+	if err := enc.Encode(root); err != nil {
 		return nil, fmt.Errorf("failed to encode YAML: %w", err)
 	}
 
 	return buf.Bytes(), nil
 }
 
+// renameAliases points the aliases below node at the current anchor name of
+// the node they refer to. The encoder writes an alias by its own Value, so an
+// anchor renamed during the update (see the anchor tag option) would leave
+// them dangling.
+func renameAliases(node *yaml.Node) {
+	if node.Kind == yaml.AliasNode && node.Alias != nil && node.Alias.Anchor != "" {
+		node.Value = node.Alias.Anchor
+	}
+	for _, child := range node.Content {
+		renameAliases(child)
+	}
+}
+
+// verify re-parses the final output of encode and checks it decodes to the
+// same data as the tree it was encoded from. The BOM, the checksum line and
+// the root indentation are taken off first and template actions masked again,
+// as parseDocument would on the next update.
+func (doc *parsedDocument) verify(out []byte, opts Options) error {
+	out = bytes.TrimPrefix(out, utf8BOM)
+	if opts.AppendChecksum {
+		out = stripChecksum(out)
+	}
+	out = unshiftColumns(out, opts.RootColumn)
+
+	var mask *templateMask
+	if doc.templates != nil {
+		out, mask = maskTemplates(out)
+		doc.templates.unmaskNode(&doc.root)
+	}
+
+	var want, got interface{}
+	if err := doc.root.Decode(&want); err != nil {
+		return fmt.Errorf("%w: %v", ErrVerificationFailed, err)
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(out, &root); err != nil {
+		return fmt.Errorf("%w: %v", ErrVerificationFailed, err)
+	}
+	if mask != nil {
+		mask.unmaskNode(&root)
+	}
+	if err := root.Decode(&got); err != nil {
+		return fmt.Errorf("%w: %v", ErrVerificationFailed, err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		return fmt.Errorf("%w: output does not decode to the updated data", ErrVerificationFailed)
+	}
+	return nil
+}
+
+// shiftColumns indents every non-empty line of encoded YAML by column spaces.
+// The encoder always writes the root at column 0, so documents meant to be
+// embedded in another one are shifted as a whole afterwards; relative
+// indentation, block scalars included, is left intact.
+func shiftColumns(content []byte, column int) []byte {
+	if column <= 0 {
+		return content
+	}
+
+	prefix := bytes.Repeat([]byte(" "), column)
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	var buf bytes.Buffer
+	for _, line := range lines {
+		if len(bytes.TrimSpace(line)) > 0 {
+			buf.Write(prefix)
+		}
+		buf.Write(line)
+	}
+	return buf.Bytes()
+}
+
+// unshiftColumns undoes shiftColumns, removing up to column leading spaces
+// from every line.
+func unshiftColumns(content []byte, column int) []byte {
+	if column <= 0 {
+		return content
+	}
+
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	var buf bytes.Buffer
+	for _, line := range lines {
+		n := 0
+		for n < column && n < len(line) && line[n] == ' ' {
+			n++
+		}
+		buf.Write(line[n:])
+	}
+	return buf.Bytes()
+}
+
+// expandLeadingTabs replaces the tabs in the indentation of every line with
+// spaces, each tab advancing to the next multiple of indent columns. Tabs after
+// the first non-blank character are kept.
+func expandLeadingTabs(content []byte, indent int) []byte {
+	if indent <= 0 {
+		indent = 2
+	}
+	lines := bytes.Split(content, []byte("\n"))
+	for i, line := range lines {
+		trimmed := bytes.TrimLeft(line, " \t")
+		leading := line[:len(line)-len(trimmed)]
+		if bytes.IndexByte(leading, '\t') < 0 {
+			continue
+		}
+		column := 0
+		for _, c := range leading {
+			if c == '\t' {
+				column = (column/indent + 1) * indent
+			} else {
+				column++
+			}
+		}
+		lines[i] = append(bytes.Repeat([]byte(" "), column), trimmed...)
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
+// tabIndentedLine returns the 1-based number of the first line whose
+// indentation starts with a tab, or 0 if there is none.
+func tabIndentedLine(content []byte) int {
+	for i, line := range bytes.Split(content, []byte("\n")) {
+		trimmed := bytes.TrimLeft(line, " ")
+		if len(trimmed) > 0 && trimmed[0] == '\t' && len(bytes.TrimSpace(trimmed)) > 0 {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// detectIndentation guesses the number of spaces per indentation level from
+// the step between a mapping key and its first nested key. Files with no such
+// pair fall back to the indentation of the first nested line, and to 2 if
+// there is none. Comments and tab-indented lines are ignored.
 func detectIndentation(content string) int {
+	// Measure relative to the root so that a document indented as a whole
+	// (see Options.RootColumn) is detected the same as one starting at column 0
+	base := -1
+	fallback := -1
+	keyColumn := -1
 	lines := bytes.Split([]byte(content), []byte("\n"))
 	for _, line := range lines {
-		if len(line) == 0 || line[0] != ' ' {
+		trimmed := bytes.TrimLeft(line, " ")
+		if len(trimmed) == 0 || trimmed[0] == '\t' || trimmed[0] == '#' {
+			// Tab indentation says nothing about the width of a level in spaces
 			continue
 		}
+		spaces := len(line) - len(trimmed)
 
-		spaces := 0
-		for _, ch := range line {
-			if ch == ' ' {
-				spaces++
-			} else {
-				break
-			}
+		if keyColumn >= 0 && spaces > keyColumn && !isDashLine(trimmed) {
+			return spaces - keyColumn
+		}
+		keyColumn = -1
+		if endsWithKey(line) {
+			keyColumn = contentColumn(line)
 		}
 
-		if spaces > 0 {
-			return spaces
+		if base < 0 {
+			base = spaces
+		} else if fallback < 0 && spaces > base {
+			fallback = spaces - base
 		}
 	}
 
+	if fallback > 0 {
+		return fallback
+	}
 	return 2
 }
 
-func updateYamlFromStruct(node *yaml.Node, data interface{}) error {
+func (u *updater) updateYamlFromStruct(node *yaml.Node, data interface{}) error {
 	val := reflect.ValueOf(data)
 	if val.Kind() == reflect.Ptr {
 		val = val.Elem()
@@ -79,58 +534,247 @@ func updateYamlFromStruct(node *yaml.Node, data interface{}) error {
 		adjustNodeColumns(mappingNode, rootOffset)
 	}
 
-	if mappingNode.Kind != yaml.MappingNode {
-		mappingNode.Kind = yaml.MappingNode
-		mappingNode.Tag = "!!map"
-	}
+	setCollectionKind(mappingNode, yaml.MappingNode, "!!map")
 	if mappingNode.Content == nil {
 		mappingNode.Content = []*yaml.Node{}
 	}
 
 	switch val.Kind() {
 	case reflect.Struct:
-		typ := val.Type()
-		for i := 0; i < val.NumField(); i++ {
-			if err := updateField(mappingNode, typ.Field(i), val.Field(i)); err != nil {
-				return fmt.Errorf("failed to update field %s: %w", typ.Field(i).Name, err)
+		// Keys owned by typed fields win over the same keys in an inline map
+		typedKeys := map[string]bool{}
+		var inlineMaps []inlineMap
+		if err := u.collectFieldKeys(val, typedKeys, &inlineMaps); err != nil {
+			return err
+		}
+
+		if err := u.updateStructFields(mappingNode, val); err != nil {
+			return err
+		}
+
+		for _, m := range inlineMaps {
+			if err := u.updateMapEntries(mappingNode, m.value, typedKeys); err != nil {
+				return fmt.Errorf("failed to update field %s: %w", m.name, err)
 			}
 		}
+
+		if u.opts.PruneUnknownKeys {
+			known := map[string]bool{}
+			for key := range typedKeys {
+				known[key] = true
+			}
+			for _, m := range inlineMaps {
+				for _, key := range m.value.MapKeys() {
+					known[fmt.Sprintf("%v", key.Interface())] = true
+				}
+			}
+			u.pruneKeys(mappingNode, known)
+		}
 	case reflect.Map:
-		if val.Type().Key().Kind() != reflect.String {
-			return fmt.Errorf("map key must be string")
+		if err := u.updateMapEntries(mappingNode, val, nil); err != nil {
+			return err
 		}
-		for _, key := range val.MapKeys() {
-			keyStr := key.String()
-			keyNode, valueNode, found := findNodes(mappingNode, keyStr)
-			if !found {
-				keyNode = &yaml.Node{
-					Kind:  yaml.ScalarNode,
-					Tag:   "!!str",
-					Value: keyStr,
-				}
-				valueNode = &yaml.Node{}
-				if len(mappingNode.Content) > 0 {
-					keyNode.Style = mappingNode.Content[0].Style
-					keyNode.Column = mappingNode.Content[0].Column
-					valueNode.Style = mappingNode.Content[1].Style
-					valueNode.Column = mappingNode.Content[1].Column
-				} else {
-					keyNode.Column = mappingNode.Column + 2
-					valueNode.Column = mappingNode.Column + 2
+	default:
+		return fmt.Errorf("data must be a struct, pointer to struct, or map[string]interface{}")
+	}
+
+	return nil
+}
+
+// inlineMap is a map field tagged inline, whose entries are spread into the
+// mapping holding it.
+type inlineMap struct {
+	name  string
+	value reflect.Value
+}
+
+// collectFieldKeys records the keys the fields of the struct val map to in
+// keys, and its inline map fields in maps, descending into inline structs.
+func (u *updater) collectFieldKeys(val reflect.Value, keys map[string]bool, maps *[]inlineMap) error {
+	typ := val.Type()
+	fields, err := orderedFields(typ)
+	if err != nil {
+		return err
+	}
+	for _, i := range fields {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if embedded, ok := u.inlineStruct(field, val.Field(i)); ok {
+			if embedded.IsValid() {
+				if err := u.collectFieldKeys(embedded, keys, maps); err != nil {
+					return err
 				}
-				mappingNode.Content = append(mappingNode.Content, keyNode, valueNode)
 			}
-			if err := updateNode(valueNode, val.MapIndex(key)); err != nil {
-				return fmt.Errorf("failed to update map value for key %s: %w", keyStr, err)
+			continue
+		}
+		if tag := parseFieldTag(field, u.opts.tagName()); tag.inline && val.Field(i).Kind() == reflect.Map {
+			*maps = append(*maps, inlineMap{name: field.Name, value: val.Field(i)})
+		} else if !tag.skip {
+			keys[tag.name] = true
+		}
+	}
+	return nil
+}
+
+// updateStructFields writes the fields of the struct val into mappingNode.
+// Fields of inline structs land in mappingNode as well; inline maps are left
+// to the caller.
+func (u *updater) updateStructFields(mappingNode *yaml.Node, val reflect.Value) error {
+	typ := val.Type()
+	fields, err := orderedFields(typ)
+	if err != nil {
+		return err
+	}
+	for _, i := range fields {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			// Like yaml.v3, ignore unexported fields; they can't be read through reflection anyway
+			continue
+		}
+		if u.opts.OnlyNonNilPointers && val.Field(i).Kind() == reflect.Ptr && val.Field(i).IsNil() {
+			continue
+		}
+		if embedded, ok := u.inlineStruct(field, val.Field(i)); ok {
+			if embedded.IsValid() {
+				if err := u.updateStructFields(mappingNode, embedded); err != nil {
+					return fmt.Errorf("failed to update field %s: %w", field.Name, err)
+				}
 			}
+			continue
+		}
+		if parseFieldTag(field, u.opts.tagName()).inline && val.Field(i).Kind() == reflect.Map {
+			continue
+		}
+		if err := u.updateField(mappingNode, field, val.Field(i)); err != nil {
+			return fmt.Errorf("failed to update field %s: %w", field.Name, err)
 		}
-	default:
-		return fmt.Errorf("data must be a struct, pointer to struct, or map[string]interface{}")
+	}
+	return nil
+}
+
+// inlineStruct reports whether field spreads its fields into the mapping
+// holding it, which is the case for a struct tagged inline and for an
+// embedded struct whose tag gives no key name. The returned struct is invalid
+// if field is a nil pointer.
+func (u *updater) inlineStruct(field reflect.StructField, value reflect.Value) (reflect.Value, bool) {
+	typ := field.Type
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+
+	tag := parseFieldTag(field, u.opts.tagName())
+	named := strings.Split(field.Tag.Get(u.opts.tagName()), ",")[0] != ""
+	if tag.skip || !(tag.inline || field.Anonymous && !named) {
+		return reflect.Value{}, false
 	}
 
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return reflect.Value{}, true
+		}
+		value = value.Elem()
+	}
+	return value, true
+}
+
+// updateMapEntries writes every entry of the string-keyed map val into
+// mappingNode, reusing existing keys and appending new ones. Keys in skip are
+// left alone.
+func (u *updater) updateMapEntries(mappingNode *yaml.Node, val reflect.Value, skip map[string]bool) error {
+	keyTag := mapKeyTag(val.Type().Key().Kind())
+	if keyTag == "" {
+		return fmt.Errorf("map key must be a string, integer or bool")
+	}
+	for _, key := range sortedMapKeys(val, u.opts.MapKeyOrder) {
+		keyStr := fmt.Sprintf("%v", key.Interface())
+		if skip[keyStr] {
+			continue
+		}
+		keyNode, valueNode, found := u.findNodes(mappingNode, keyStr)
+		if found && u.fillOnly {
+			continue
+		}
+		if !u.managed(lineOf(keyNode)) {
+			if !found {
+				continue
+			}
+			u.enter(keyStr)
+			err := u.updateUnmanaged(valueNode, val.MapIndex(key))
+			u.leave()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if !found {
+			keyNode, valueNode = u.appendPair(mappingNode, keyStr)
+			keyNode.Tag = keyTag
+		}
+		u.enter(keyStr)
+		err := u.updateNode(valueNode, val.MapIndex(key))
+		u.leave()
+		if err != nil {
+			return fmt.Errorf("failed to update map value for key %s: %w", keyStr, err)
+		}
+	}
 	return nil
 }
 
+// orderedFields returns the field indices of typ in the order their keys should
+// be emitted. Fields with an `order:"N"` tag come first, sorted by N, followed by
+// the remaining fields in declaration order.
+func orderedFields(typ reflect.Type) ([]int, error) {
+	type orderedField struct {
+		index int
+		order int
+	}
+
+	var ordered []orderedField
+	var rest []int
+	for i := 0; i < typ.NumField(); i++ {
+		tag, ok := typ.Field(i).Tag.Lookup("order")
+		if !ok {
+			rest = append(rest, i)
+			continue
+		}
+		order, err := strconv.Atoi(tag)
+		if err != nil {
+			return nil, fmt.Errorf("invalid order tag %q on field %s: %w", tag, typ.Field(i).Name, err)
+		}
+		ordered = append(ordered, orderedField{index: i, order: order})
+	}
+
+	sort.SliceStable(ordered, func(a, b int) bool {
+		return ordered[a].order < ordered[b].order
+	})
+
+	fields := make([]int, 0, typ.NumField())
+	for _, f := range ordered {
+		fields = append(fields, f.index)
+	}
+	return append(fields, rest...), nil
+}
+
+// setCollectionKind turns node into a collection of the given kind. The tag is
+// only set when the node changes kind or has none, so a node that already was a
+// collection keeps its (possibly custom) tag and the resolved tag stays implicit
+// in the output instead of showing up as an explicit !!map/!!seq.
+// Content left over from a node of another kind is dropped.
+func setCollectionKind(node *yaml.Node, kind yaml.Kind, tag string) {
+	if node.Kind != kind {
+		node.Content = nil
+	}
+	if node.Kind != kind || node.Tag == "" {
+		node.Tag = tag
+	}
+	node.Kind = kind
+}
+
 func adjustNodeColumns(node *yaml.Node, offset int) {
 	if node.Column > offset {
 		node.Column -= offset
@@ -140,108 +784,818 @@ func adjustNodeColumns(node *yaml.Node, offset int) {
 	}
 }
 
-func updateField(mappingNode *yaml.Node, fieldType reflect.StructField, fieldValue reflect.Value) error {
-	yamlTag := fieldType.Tag.Get("yaml")
-	if yamlTag == "" {
-		yamlTag = fieldType.Name
+func (u *updater) updateField(mappingNode *yaml.Node, fieldType reflect.StructField, fieldValue reflect.Value) error {
+	tag := parseFieldTag(fieldType, u.opts.tagName())
+	if tag.skip {
+		return nil
+	}
+	yamlTag := tag.name
+	if yamlTag == "<<" {
+		return fmt.Errorf("%w: field %s is tagged %q", ErrMergeKey, fieldType.Name, yamlTag)
+	}
+
+	u.enter(yamlTag)
+	defer u.leave()
+	if u.opts.FieldFilter != nil && !u.opts.FieldFilter(u.currentPath(), fieldType) {
+		return nil
 	}
 
-	keyNode, valueNode, found := findNodes(mappingNode, yamlTag)
+	keyNode, valueNode, found := u.findNodes(mappingNode, yamlTag)
+	if found && tag.immutable {
+		return nil
+	}
+	if !u.managed(lineOf(keyNode)) {
+		if !found {
+			return nil
+		}
+		return u.updateUnmanaged(valueNode, fieldValue)
+	}
+	if found && u.fillOnly {
+		return u.fillExisting(valueNode, fieldValue)
+	}
+	if !found && u.collectMissing {
+		u.missing = append(u.missing, u.currentPath())
+		return nil
+	}
+	if found && tag.omitempty && isEmptyValue(fieldValue) {
+		// A key holding the default of an empty field is left as written
+		if _, ok := fieldType.Tag.Lookup("default"); ok {
+			return nil
+		}
+		removePair(mappingNode, keyNode)
+		u.changes++
+		return nil
+	}
 	if !found {
-		keyNode = &yaml.Node{
-			Kind:  yaml.ScalarNode,
-			Tag:   "!!str",
-			Value: yamlTag,
-		}
-		valueNode = &yaml.Node{}
-		if len(mappingNode.Content) > 0 {
-			keyNode.Style = mappingNode.Content[0].Style
-			keyNode.Column = mappingNode.Content[0].Column
-			valueNode.Style = mappingNode.Content[1].Style
-			valueNode.Column = mappingNode.Content[1].Column
-		} else {
-			keyNode.Column = mappingNode.Column + 2
-			valueNode.Column = mappingNode.Column + 2
+		if def, ok := fieldType.Tag.Lookup("default"); ok && fieldValue.IsZero() {
+			defValue, err := parseDefault(def, fieldType.Type)
+			if err != nil {
+				return fmt.Errorf("invalid default for field %s: %w", fieldType.Name, err)
+			}
+			fieldValue = defValue
+		}
+		if tag.omitempty && isEmptyValue(fieldValue) {
+			return nil
+		}
+		if u.opts.ZeroValuePolicy == ZeroOmitIfAbsent && fieldValue.IsZero() {
+			return nil
 		}
-		mappingNode.Content = append(mappingNode.Content, keyNode, valueNode)
+
+		keyNode, valueNode = u.appendPair(mappingNode, yamlTag)
+	}
+
+	if tag.anchor {
+		if fieldValue.Kind() != reflect.String {
+			return fmt.Errorf("anchor field %s must be a string", fieldType.Name)
+		}
+		if anchor := fieldValue.String(); anchor != "" {
+			mappingNode.Anchor = anchor
+		}
+	}
+
+	if u.opts.ZeroValuePolicy == ZeroNull && fieldValue.IsZero() {
+		var null interface{}
+		fieldValue = reflect.ValueOf(&null).Elem()
+	} else if fieldType.Tag.Get("style") == "json" {
+		// The field is written as a string holding its compact JSON encoding
+		data, err := json.Marshal(fieldValue.Interface())
+		if err != nil {
+			return fmt.Errorf("failed to marshal field %s as JSON: %w", fieldType.Name, err)
+		}
+		fieldValue = reflect.ValueOf(string(data))
+	}
+
+	if err := u.updateNode(valueNode, fieldValue); err != nil {
+		return err
+	}
+	if values, ok := fieldType.Tag.Lookup("enum"); ok {
+		setEnumHint(keyNode, valueNode, values, !found)
+	}
+	return nil
+}
+
+// setEnumHint documents the values an `enum:"low,medium,high"` field accepts
+// with a "# one of: low, medium, high" line comment. An existing key keeps its
+// own line comment; a new one gets the hint even if it copied its
+// neighbour's (see Options.CopyLineComments).
+func setEnumHint(keyNode, valueNode *yaml.Node, values string, created bool) {
+	if !created && (keyNode.LineComment != "" || valueNode.LineComment != "") {
+		return
+	}
+	options := strings.Split(values, ",")
+	for i := range options {
+		options[i] = strings.TrimSpace(options[i])
 	}
+	hint := "# one of: " + strings.Join(options, ", ")
 
-	return updateNode(valueNode, fieldValue)
+	keyNode.LineComment, valueNode.LineComment = "", ""
+	if valueNode.Kind == yaml.ScalarNode {
+		valueNode.LineComment = hint
+	} else {
+		keyNode.LineComment = hint
+	}
+}
+
+// pruneKeys removes the pairs of mappingNode whose key is not in known, taking
+// Options.KeyMatcher into account. Merge keys and keys outside a managed
+// region are kept.
+func (u *updater) pruneKeys(mappingNode *yaml.Node, known map[string]bool) {
+	// KeyMatcher sees the names in a fixed order, in case it is not symmetric
+	names := make([]string, 0, len(known))
+	for name := range known {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	isKnown := func(key string) bool {
+		if known[key] {
+			return true
+		}
+		if u.opts.KeyMatcher != nil {
+			for _, name := range names {
+				if u.opts.KeyMatcher(key, name) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	kept := mappingNode.Content[:0]
+	for i := 0; i+1 < len(mappingNode.Content); i += 2 {
+		keyNode := mappingNode.Content[i]
+		if keyNode.ShortTag() == "!!merge" || !u.managed(keyNode.Line) || isKnown(keyValue(keyNode)) {
+			kept = append(kept, keyNode, mappingNode.Content[i+1])
+			continue
+		}
+		u.enter(keyValue(keyNode))
+		u.pruned = append(u.pruned, u.currentPath())
+		u.debug("pruning unknown key")
+		u.leave()
+		u.changes++
+	}
+	mappingNode.Content = kept
+}
+
+// appendPair adds a new key with an empty value to mappingNode, placed like
+// the mapping's last pair (see placeLikeLastPair).
+func (u *updater) appendPair(mappingNode *yaml.Node, key string) (keyNode, valueNode *yaml.Node) {
+	keyNode = &yaml.Node{
+		Kind:  yaml.ScalarNode,
+		Tag:   "!!str",
+		Value: key,
+	}
+	valueNode = &yaml.Node{}
+	if len(mappingNode.Content) > 0 {
+		u.placeLikeLastPair(keyNode, valueNode, mappingNode.Content)
+	} else {
+		keyNode.Column = mappingNode.Column + 2
+		valueNode.Column = mappingNode.Column + 2
+	}
+	valueNode.Style |= mappingNode.Style & yaml.FlowStyle
+	mappingNode.Content = append(mappingNode.Content, keyNode, valueNode)
+	return keyNode, valueNode
+}
+
+// placeLikeLastPair gives a new pair the columns of the last pair of the
+// non-empty content, and its line comments if Options.CopyLineComments is
+// set. Quoting is not copied: the new scalars are quoted only when their own
+// text needs it. Head comments are never copied, as they describe the pair
+// they sit above.
+func (u *updater) placeLikeLastPair(keyNode, valueNode *yaml.Node, content []*yaml.Node) {
+	templateKey := content[len(content)-2]
+	templateValue := content[len(content)-1]
+	keyNode.Column = templateKey.Column
+	valueNode.Column = templateValue.Column
+	if !u.opts.CopyLineComments {
+		return
+	}
+	keyNode.LineComment = templateKey.LineComment
+	if templateValue.Kind == yaml.ScalarNode {
+		valueNode.LineComment = templateValue.LineComment
+	}
+}
+
+// removePair removes keyNode and its value from mappingNode.
+func removePair(mappingNode, keyNode *yaml.Node) {
+	for i := 0; i+1 < len(mappingNode.Content); i += 2 {
+		if mappingNode.Content[i] == keyNode {
+			mappingNode.Content = append(mappingNode.Content[:i], mappingNode.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+// lineOf returns the line of node, or 0 for a missing node.
+func lineOf(node *yaml.Node) int {
+	if node == nil {
+		return 0
+	}
+	return node.Line
+}
+
+// keyValue returns the text of a mapping key, looking through an alias to the
+// anchored node it refers to. Alias nodes carry no value of their own, so
+// comparing them directly would never match and keep appending duplicates.
+func keyValue(key *yaml.Node) string {
+	if key.Kind == yaml.AliasNode && key.Alias != nil {
+		return key.Alias.Value
+	}
+	return key.Value
 }
 
 func findNodes(mappingNode *yaml.Node, key string) (keyNode, valueNode *yaml.Node, found bool) {
 	for i := 0; i < len(mappingNode.Content); i += 2 {
-		if mappingNode.Content[i].Value == key {
+		if keyValue(mappingNode.Content[i]) == key {
+			return mappingNode.Content[i], mappingNode.Content[i+1], true
+		}
+	}
+	return nil, nil, false
+}
+
+// findNodes looks key up like the package-level findNodes and falls back to
+// the KeyAliases and KeyMatcher options when no key matches exactly. A key
+// found through an alias is renamed to key.
+func (u *updater) findNodes(mappingNode *yaml.Node, key string) (keyNode, valueNode *yaml.Node, found bool) {
+	if keyNode, valueNode, found = findNodes(mappingNode, key); found {
+		return keyNode, valueNode, found
+	}
+	for i := 0; i+1 < len(mappingNode.Content) && u.opts.KeyAliases != nil; i += 2 {
+		if u.opts.KeyAliases[keyValue(mappingNode.Content[i])] == key {
+			u.debug("renaming aliased key", "from", mappingNode.Content[i].Value, "to", key)
+			mappingNode.Content[i].Value = key
+			u.changes++
+			return mappingNode.Content[i], mappingNode.Content[i+1], true
+		}
+	}
+	if u.opts.KeyMatcher == nil {
+		return nil, nil, false
+	}
+	for i := 0; i+1 < len(mappingNode.Content); i += 2 {
+		if u.opts.KeyMatcher(keyValue(mappingNode.Content[i]), key) {
 			return mappingNode.Content[i], mappingNode.Content[i+1], true
 		}
 	}
 	return nil, nil, false
 }
 
-func updateNode(node *yaml.Node, value reflect.Value) error {
+func (u *updater) updateNode(node *yaml.Node, value reflect.Value) error {
 	originalStyle := node.Style
 	originalColumn := node.Column
+	originalTag := node.Tag
+	originalKind := node.Kind
+	originalValue := node.Value
+
+	if u.opts.OnlyFillEmpty && node.Kind == yaml.ScalarNode && node.ShortTag() != "!!null" && node.Value != "" {
+		u.debug("keeping existing value")
+		return nil
+	}
+
+	if value.IsValid() && value.Type() == placeholderType {
+		node.Kind = yaml.ScalarNode
+		node.Tag = "!!null"
+		node.Value = ""
+		node.Style = 0
+		node.Content = nil
+		node.LineComment = "# " + value.Interface().(Placeholder).Comment
+		return nil
+	}
+
+	if marshaler, ok := asMarshaler(value); ok {
+		marshaled, err := marshaler.MarshalYAML()
+		if err != nil {
+			return fmt.Errorf("MarshalYAML failed at %s: %w", u.currentPath(), err)
+		}
+		switch result := marshaled.(type) {
+		case *yaml.Node:
+			if result != nil {
+				u.replaceWithNode(node, result)
+				return nil
+			}
+		case yaml.Node:
+			u.replaceWithNode(node, &result)
+			return nil
+		}
+		return u.updateNode(node, reflect.ValueOf(&marshaled).Elem())
+	}
+	if marshaler, ok := asTextMarshaler(value); ok {
+		text, err := marshaler.MarshalText()
+		if err != nil {
+			return fmt.Errorf("MarshalText failed at %s: %w", u.currentPath(), err)
+		}
+		return u.updateNode(node, reflect.ValueOf(string(text)))
+	}
+
+	u.debug("updating node", "kind", value.Kind().String(), "line", node.Line)
+
+	// formatted is set when Options.ScalarFormatters rendered the value
+	formatted := false
+	var formattedStyle yaml.Style
 
 	switch value.Kind() {
-	case reflect.Interface:
+	case reflect.Interface, reflect.Ptr:
 		if !value.IsNil() {
-			return updateNode(node, value.Elem())
+			return u.updateNode(node, value.Elem())
 		}
+		// Spell out null rather than leaving an empty value that reads like a
+		// missing block; existing ~ or empty nulls keep their spelling below
 		node.Kind = yaml.ScalarNode
 		node.Tag = "!!null"
-		node.Value = ""
+		node.Value = "null"
+		node.Content = nil
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return fmt.Errorf("%w: %s at %s", ErrUnsupportedType, value.Type(), u.currentPath())
 	case reflect.Struct:
-		if err := updateYamlFromStruct(node, value.Interface()); err != nil {
+		if value.Type() == timeType {
+			node.Kind = yaml.ScalarNode
+			node.Content = nil
+			node.Tag = "!!timestamp"
+			node.Value = value.Interface().(time.Time).Format(time.RFC3339Nano)
+			if originalKind == yaml.ScalarNode && originalStyle&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle) != 0 {
+				// A date the file quoted is a string to its readers
+				node.Tag = "!!str"
+			}
+			break
+		}
+		if err := u.updateYamlFromStruct(node, value.Interface()); err != nil {
 			return err
 		}
 	case reflect.Slice, reflect.Array:
-		if err := updateSequence(node, value); err != nil {
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			// Byte slices and fixed byte arrays (hashes, keys) are binary data, not lists of numbers
+			data := make([]byte, value.Len())
+			reflect.Copy(reflect.ValueOf(data), value)
+			node.Kind = yaml.ScalarNode
+			node.Tag = "!!binary"
+			node.Value = base64.StdEncoding.EncodeToString(data)
+			node.Content = nil
+			break
+		}
+		if err := u.updateSequence(node, value); err != nil {
 			return err
 		}
 	case reflect.Map:
-		if err := updateMapping(node, value); err != nil {
+		if err := u.updateMapping(node, value); err != nil {
 			return err
 		}
 	default:
 		node.Kind = yaml.ScalarNode
+		node.Content = nil
 		switch value.Kind() {
 		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 			node.Tag = "!!int"
 			node.Value = fmt.Sprintf("%d", value.Int())
+			if value.Type() == durationType {
+				// Written like 30s rather than as nanoseconds, which is how time.ParseDuration reads it back
+				node.Tag = "!!str"
+				node.Value = time.Duration(value.Int()).String()
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			node.Tag = "!!int"
+			node.Value = strconv.FormatUint(value.Uint(), 10)
 		case reflect.Float32, reflect.Float64:
 			node.Tag = "!!float"
-			node.Value = fmt.Sprintf("%g", value.Float())
+			node.Value = formatFloat(value.Float(), value.Type().Bits())
 		case reflect.Bool:
 			node.Tag = "!!bool"
 			node.Value = fmt.Sprintf("%v", value.Bool())
+			if b, ok := legacyBool(originalValue); ok && b == value.Bool() && !u.opts.NormalizeScalars &&
+				originalKind == yaml.ScalarNode && originalStyle&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle) == 0 {
+				// Unchanged: keep whatever spelling the file used
+				node.Tag = originalTag
+				node.Value = originalValue
+			} else if u.opts.BoolStyle != TrueFalse {
+				// yes/no and on/off are plain strings to a YAML 1.2 parser, so
+				// tag them as such to keep the encoder from adding an explicit !!bool
+				node.Tag = "!!str"
+				node.Value = u.opts.BoolStyle.format(value.Bool())
+				originalStyle = 0
+			}
 		case reflect.String:
+			str, err := u.substitute(value.String())
+			if err != nil {
+				return err
+			}
 			node.Tag = "!!str"
-			node.Value = value.String()
+			node.Value = str
+			// Keep timestamps typed as such as long as the new value is still a valid date
+			if originalTag == "!!timestamp" && isTimestamp(node.Value) {
+				node.Tag = "!!timestamp"
+			}
 		default:
 			// For any other type, convert to string
 			node.Tag = "!!str"
 			node.Value = fmt.Sprintf("%v", value.Interface())
 		}
+
+		if format, ok := u.opts.ScalarFormatters[scalarTag(value.Kind())]; ok && value.Type() != durationType {
+			node.Tag = scalarTag(value.Kind())
+			node.Value, formattedStyle = format(value)
+			formatted = true
+		}
+	}
+
+	if u.opts.CoerceToExistingTag && node.Kind == yaml.ScalarNode && originalKind == yaml.ScalarNode &&
+		coercible(node, originalTag) {
+		node.Tag = originalTag
+	}
+
+	if node.Kind == yaml.ScalarNode && !u.opts.NormalizeScalars && !formatted && originalKind == yaml.ScalarNode &&
+		originalTag == node.Tag && sameScalar(node.Tag, originalValue, node.Value) {
+		// Keep the original spelling (1_000, True, 0x10, ~, ...) of unchanged values
+		node.Value = originalValue
 	}
 
 	// Don't quote numbers and booleans
 	if node.Tag == "!!int" || node.Tag == "!!float" || node.Tag == "!!bool" {
 		node.Style = 0
+	} else if u.opts.NormalizeScalars && node.Kind == yaml.ScalarNode {
+		// Let the encoder decide whether the string needs quoting
+		node.Style = 0
 	} else {
+		// Strings keep their quoting, and literal (|) and folded (>) blocks stay
+		// blocks; the encoder re-folds new paragraphs of a folded block
 		node.Style = originalStyle
 	}
+	if formatted {
+		node.Style = formattedStyle
+	}
+
+	if u.opts.Schema == Legacy11 && node.Tag == "!!str" && value.Kind() != reflect.Bool &&
+		node.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 &&
+		isLegacyAmbiguous(node.Value) {
+		// A YAML 1.1 parser would read this string as a bool, null or number
+		node.Style = yaml.DoubleQuotedStyle
+	}
+
+	plain := node.Value
+	if u.opts.PreserveTemplates {
+		// Template actions are masked before encoding, so they never force quotes
+		plain = templateExpr.ReplaceAllString(plain, "tpl")
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" &&
+		node.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 &&
+		needsQuoting(plain) {
+		node.Style = yaml.DoubleQuotedStyle
+	}
+
+	if u.opts.CompactFlowThreshold > 0 && isSmallScalarCollection(node, u.opts.CompactFlowThreshold) {
+		node.Style |= yaml.FlowStyle
+	}
+
+	if originalKind == yaml.ScalarNode {
+		moveLineCommentInside(node)
+	}
+
+	// An explicit tag written for the old value must not be carried over to a value of another type
+	if node.Tag != originalTag {
+		node.Style &^= yaml.TaggedStyle
+	}
+
+	if node.Kind == yaml.ScalarNode &&
+		(originalKind != yaml.ScalarNode || node.Value != originalValue || node.Tag != originalTag) {
+		u.changes++
+	}
+
+	if u.opts.VerifyScalars {
+		if err := u.verifyScalar(node, value); err != nil {
+			return err
+		}
+	}
 
 	node.Column = originalColumn
 	return nil
 }
 
-func updateSequence(node *yaml.Node, value reflect.Value) error {
+// verifyScalar checks that the numeric scalar written to node decodes back to
+// exactly value, so that no precision is lost between Go and the file.
+func (u *updater) verifyScalar(node *yaml.Node, value reflect.Value) error {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+	default:
+		return nil
+	}
+
+	decoded := reflect.New(value.Type())
+	if err := node.Decode(decoded.Interface()); err != nil {
+		return fmt.Errorf("%w: %q at %s does not decode as %s: %v",
+			ErrVerificationFailed, node.Value, u.currentPath(), value.Type(), err)
+	}
+	got := decoded.Elem()
+	if got.Type() != value.Type() {
+		got = got.Convert(value.Type())
+	}
+	same := got.Interface() == value.Interface()
+	if value.Kind() == reflect.Float32 || value.Kind() == reflect.Float64 {
+		same = same || (math.IsNaN(got.Float()) && math.IsNaN(value.Float()))
+	}
+	if !same {
+		return fmt.Errorf("%w: %q at %s decodes to %v, not %v",
+			ErrVerificationFailed, node.Value, u.currentPath(), got.Interface(), value.Interface())
+	}
+	return nil
+}
+
+// isSmallScalarCollection reports whether node is a sequence or mapping of at
+// most limit entries that all are scalars.
+func isSmallScalarCollection(node *yaml.Node, limit int) bool {
+	entries := len(node.Content)
+	switch node.Kind {
+	case yaml.SequenceNode:
+	case yaml.MappingNode:
+		entries /= 2
+	default:
+		return false
+	}
+	if entries > limit {
+		return false
+	}
+	for _, child := range node.Content {
+		if child.Kind != yaml.ScalarNode {
+			return false
+		}
+	}
+	return true
+}
+
+// moveLineCommentInside keeps the trailing comment of a scalar that was turned
+// into a block collection on the line it was written on. Left on the collection
+// node, the encoder would emit it after the collection's last entry instead, so
+// `- foo # note` ending up as a mapping is rendered `- key: value # note`.
+func moveLineCommentInside(node *yaml.Node) {
+	if node.LineComment == "" || node.Style&yaml.FlowStyle != 0 || len(node.Content) == 0 {
+		return
+	}
+
+	var target *yaml.Node
+	switch node.Kind {
+	case yaml.MappingNode:
+		target = node.Content[0]
+		if len(node.Content) > 1 && node.Content[1].Kind == yaml.ScalarNode {
+			target = node.Content[1]
+		}
+	case yaml.SequenceNode:
+		target = node.Content[0]
+	default:
+		return
+	}
+	if target.Kind != yaml.ScalarNode || target.LineComment != "" {
+		return
+	}
+
+	target.LineComment = node.LineComment
+	node.LineComment = ""
+}
+
+// asMarshaler returns the yaml.Marshaler implemented by value or, when value is
+// addressable, by a pointer to it.
+func asMarshaler(value reflect.Value) (yaml.Marshaler, bool) {
+	value = indirect(value)
+	if !value.IsValid() || !value.CanInterface() {
+		return nil, false
+	}
+	if (value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface) && value.IsNil() {
+		return nil, false
+	}
+	if marshaler, ok := value.Interface().(yaml.Marshaler); ok {
+		return marshaler, true
+	}
+	if value.CanAddr() {
+		if marshaler, ok := value.Addr().Interface().(yaml.Marshaler); ok {
+			return marshaler, true
+		}
+	}
+	return nil, false
+}
+
+// asTextMarshaler returns value as an encoding.TextMarshaler, like
+// asMarshaler. time.Time is left out, as it is written as a timestamp.
+func asTextMarshaler(value reflect.Value) (encoding.TextMarshaler, bool) {
+	value = indirect(value)
+	if !value.IsValid() || !value.CanInterface() || value.Type() == timeType {
+		return nil, false
+	}
+	if (value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface) && value.IsNil() {
+		return nil, false
+	}
+	if marshaler, ok := value.Interface().(encoding.TextMarshaler); ok {
+		return marshaler, true
+	}
+	if value.CanAddr() {
+		if marshaler, ok := value.Addr().Interface().(encoding.TextMarshaler); ok {
+			return marshaler, true
+		}
+	}
+	return nil, false
+}
+
+// indirect follows the non-nil pointers and interfaces around value, so a
+// *time.Time or a time.Time held in an interface{} is checked as a time.Time.
+// The value found behind a pointer is addressable, which keeps methods with
+// pointer receivers reachable.
+func indirect(value reflect.Value) reflect.Value {
+	for value.IsValid() && (value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface) && !value.IsNil() {
+		value = value.Elem()
+	}
+	return value
+}
+
+// replaceWithNode writes the node a MarshalYAML method returned over node.
+// node keeps its anchor and comments unless result brings its own.
+func (u *updater) replaceWithNode(node, result *yaml.Node) {
+	if result.Kind == yaml.DocumentNode && len(result.Content) == 1 {
+		result = result.Content[0]
+	}
+	if result.Kind == yaml.ScalarNode &&
+		(node.Kind != yaml.ScalarNode || node.Value != result.Value || node.ShortTag() != result.ShortTag()) {
+		u.changes++
+	}
+
+	node.Kind = result.Kind
+	node.Style = result.Style
+	node.Tag = result.Tag
+	node.Value = result.Value
+	node.Alias = result.Alias
+	node.Content = result.Content
+	if result.Anchor != "" {
+		node.Anchor = result.Anchor
+	}
+	if result.HeadComment != "" {
+		node.HeadComment = result.HeadComment
+	}
+	if result.LineComment != "" {
+		node.LineComment = result.LineComment
+	}
+	if result.FootComment != "" {
+		node.FootComment = result.FootComment
+	}
+}
+
+// coercible reports whether the scalar node can be retagged as tag without
+// changing what its value means: anything but null can be a string, and a
+// number or bool only if its text resolves to that type on its own.
+func coercible(node *yaml.Node, tag string) bool {
+	switch {
+	case node.Tag == tag || node.Tag == "!!null":
+		return false
+	case tag == "!!str":
+		return true
+	case tag == "!!int" || tag == "!!float" || tag == "!!bool":
+		return (&yaml.Node{Kind: yaml.ScalarNode, Value: node.Value}).ShortTag() == tag
+	}
+	return false
+}
+
+// legacyBool parses the YAML 1.1 boolean spellings (yes/no, on/off, true/false)
+func legacyBool(s string) (value bool, ok bool) {
+	switch strings.ToLower(s) {
+	case "true", "yes", "y", "on":
+		return true, true
+	case "false", "no", "n", "off":
+		return false, true
+	}
+	return false, false
+}
+
+// legacySexagesimal matches YAML 1.1 base 60 numbers such as 1:20:30
+var legacySexagesimal = regexp.MustCompile(`^[-+]?[0-9][0-9_]*(:[0-5]?[0-9])+(\.[0-9_]*)?$`)
+
+// isLegacyAmbiguous reports whether a YAML 1.1 parser resolves the plain
+// scalar s to something other than a string, while YAML 1.2 would not.
+func isLegacyAmbiguous(s string) bool {
+	switch s {
+	case "y", "Y", "yes", "Yes", "YES", "n", "N", "no", "No", "NO",
+		"on", "On", "ON", "off", "Off", "OFF":
+		return true
+	}
+	return legacySexagesimal.MatchString(s)
+}
+
+// needsQuoting reports whether the string s cannot be written as a plain
+// scalar: it starts with an indicator character, contains ": " or " #",
+// has surrounding whitespace or holds control characters. Multi-line strings
+// are left to the encoder, which writes them as literal blocks.
+func needsQuoting(s string) bool {
+	if s == "" || strings.Contains(s, "\n") {
+		return false
+	}
+	if strings.TrimSpace(s) != s || strings.HasSuffix(s, ":") ||
+		strings.Contains(s, ": ") || strings.Contains(s, " #") {
+		return true
+	}
+	switch s[0] {
+	case '-', '?', ':':
+		if len(s) == 1 || s[1] == ' ' {
+			return true
+		}
+	case ',', '[', ']', '{', '}', '#', '&', '*', '!', '|', '>', '\'', '"', '%', '@', '`':
+		return true
+	}
+	for _, r := range s {
+		if r != '\t' && unicode.IsControl(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatFloat renders f in its shortest form for the given bit size, keeping
+// a decimal point on integral values (2.0, not 2) so they still read as floats.
+// Infinities and NaN use the YAML spellings .inf, -.inf and .nan.
+func formatFloat(f float64, bits int) string {
+	switch {
+	case math.IsInf(f, 1):
+		return ".inf"
+	case math.IsInf(f, -1):
+		return "-.inf"
+	case math.IsNaN(f):
+		return ".nan"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, bits)
+	if !strings.ContainsAny(s, ".eEnN") {
+		s += ".0"
+	}
+	return s
+}
+
+// scalarTag returns the tag a Go value of kind is written with by default,
+// which is also its key in Options.ScalarFormatters.
+func scalarTag(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return "!!int"
+	case reflect.Float32, reflect.Float64:
+		return "!!float"
+	case reflect.Bool:
+		return "!!bool"
+	default:
+		return "!!str"
+	}
+}
+
+// sameScalar reports whether two renderings of a scalar with the given tag decode to the same value
+func sameScalar(tag, a, b string) bool {
+	if a == b {
+		return true
+	}
+
+	var va, vb interface{}
+	if err := (&yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: a}).Decode(&va); err != nil {
+		return false
+	}
+	if err := (&yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: b}).Decode(&vb); err != nil {
+		return false
+	}
+	if fa, ok := va.(float64); ok && math.IsNaN(fa) {
+		// .nan never equals itself, but .NaN and .nan are the same value
+		fb, ok := vb.(float64)
+		return ok && math.IsNaN(fb)
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// timestampFormats are the layouts yaml.v3 accepts when resolving a !!timestamp scalar
+var timestampFormats = []string{
+	"2006-1-2T15:4:5.999999999Z07:00",
+	"2006-1-2t15:4:5.999999999Z07:00",
+	"2006-1-2 15:4:5.999999999",
+	"2006-1-2",
+}
+
+func isTimestamp(value string) bool {
+	for _, format := range timestampFormats {
+		if _, err := time.Parse(format, value); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// updateSequence writes a slice or array into node. Existing elements are
+// matched by position: element i of value reuses element i of the document,
+// including its comments, and extra elements are dropped or appended at the
+// end. Comments therefore stay with the position, not with the logical item,
+// so removing the first item of a commented list shifts every comment onto
+// the item that moves into its slot.
+func (u *updater) updateSequence(node *yaml.Node, value reflect.Value) error {
+	if u.opts.MaxSequenceLen > 0 && value.Len() > u.opts.MaxSequenceLen {
+		return fmt.Errorf("%w: %d elements, limit is %d", ErrSequenceTooLong, value.Len(), u.opts.MaxSequenceLen)
+	}
+
 	originalStyle := node.Style
 	originalColumn := node.Column
-	originalContent := node.Content
+	u.debug("updating sequence", "elements", value.Len(), "existing", len(node.Content))
 
-	node.Kind = yaml.SequenceNode
-	node.Tag = "!!seq"
+	setCollectionKind(node, yaml.SequenceNode, "!!seq")
+	originalContent := node.Content
 	if node.Content == nil {
 		node.Content = []*yaml.Node{}
 	}
@@ -254,11 +1608,17 @@ func updateSequence(node *yaml.Node, value reflect.Value) error {
 	newContent := make([]*yaml.Node, 0, value.Len())
 	for i := 0; i < value.Len(); i++ {
 		elemNode := createOrReuseNode(node, i, originalContent, baseIndent)
-		if err := updateNode(elemNode, value.Index(i)); err != nil {
+		u.enterIndex(i)
+		err := u.updateNode(elemNode, value.Index(i))
+		u.leave()
+		if err != nil {
 			return fmt.Errorf("error updating sequence element %d: %w", i, err)
 		}
 		newContent = append(newContent, elemNode)
 	}
+	if u.opts.DedupScalarSequences {
+		newContent = dedupScalars(newContent)
+	}
 
 	node.Content = newContent
 	node.Style = originalStyle
@@ -266,6 +1626,27 @@ func updateSequence(node *yaml.Node, value reflect.Value) error {
 	return nil
 }
 
+// dedupScalars drops the repeated values of a sequence made only of scalars,
+// keeping the first occurrence of each. Other sequences are returned as is.
+func dedupScalars(items []*yaml.Node) []*yaml.Node {
+	for _, item := range items {
+		if item.Kind != yaml.ScalarNode {
+			return items
+		}
+	}
+
+	seen := map[string]bool{}
+	kept := items[:0]
+	for _, item := range items {
+		key := item.ShortTag() + "\x00" + item.Value
+		if !seen[key] {
+			seen[key] = true
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
 func createOrReuseNode(node *yaml.Node, index int, originalContent []*yaml.Node, baseIndent int) *yaml.Node {
 	if index < len(originalContent) {
 		return originalContent[index]
@@ -280,16 +1661,18 @@ func createOrReuseNode(node *yaml.Node, index int, originalContent []*yaml.Node,
 	} else {
 		elemNode.Column = node.Column + baseIndent
 	}
+	// Elements of a flow sequence stay in flow style however it grows
+	elemNode.Style |= node.Style & yaml.FlowStyle
 	return elemNode
 }
 
-func updateMapping(node *yaml.Node, value reflect.Value) error {
+func (u *updater) updateMapping(node *yaml.Node, value reflect.Value) error {
 	originalStyle := node.Style
 	originalColumn := node.Column
-	originalContent := node.Content
+	u.debug("updating mapping", "entries", value.Len(), "existing", len(node.Content)/2)
 
-	node.Kind = yaml.MappingNode
-	node.Tag = "!!map"
+	setCollectionKind(node, yaml.MappingNode, "!!map")
+	originalContent := node.Content
 	if node.Content == nil {
 		node.Content = []*yaml.Node{}
 	}
@@ -299,49 +1682,105 @@ func updateMapping(node *yaml.Node, value reflect.Value) error {
 		baseIndent = originalContent[0].Column - node.Column
 	}
 
-	newContent := []*yaml.Node{}
-	iter := value.MapRange()
-	for iter.Next() {
-		keyNode, valueNode := createOrReusePair(node, fmt.Sprintf("%v", iter.Key().Interface()), originalContent, baseIndent)
-		if err := updateNode(valueNode, iter.Value()); err != nil {
+	// Keys the document already has keep their place, new ones follow in key order
+	existing := map[*yaml.Node]bool{}
+	for i := 0; i+1 < len(originalContent); i += 2 {
+		existing[originalContent[i]] = false
+	}
+	var added []*yaml.Node
+	for _, mapKey := range sortedMapKeys(value, u.opts.MapKeyOrder) {
+		key := fmt.Sprintf("%v", mapKey.Interface())
+		keyNode, valueNode := u.createOrReusePair(node, key, mapKeyTag(mapKey.Kind()), originalContent, baseIndent)
+		u.enter(key)
+		err := u.updateNode(valueNode, value.MapIndex(mapKey))
+		u.leave()
+		if err != nil {
 			return fmt.Errorf("error updating map value: %w", err)
 		}
-		newContent = append(newContent, keyNode, valueNode)
+		if _, ok := existing[keyNode]; ok {
+			existing[keyNode] = true
+		} else {
+			added = append(added, keyNode, valueNode)
+		}
 	}
 
-	node.Content = newContent
+	newContent := []*yaml.Node{}
+	for i := 0; i+1 < len(originalContent); i += 2 {
+		if existing[originalContent[i]] {
+			newContent = append(newContent, originalContent[i], originalContent[i+1])
+		}
+	}
+	node.Content = append(newContent, added...)
 	node.Style = originalStyle
 	node.Column = originalColumn
 	return nil
 }
 
-func createOrReusePair(node *yaml.Node, key string, originalContent []*yaml.Node, baseIndent int) (*yaml.Node, *yaml.Node) {
-	for i := 0; i < len(originalContent); i += 2 {
-		if originalContent[i].Value == key {
-			return originalContent[i], originalContent[i+1]
+// sortedMapKeys returns the keys of a map value in a fixed order, so that
+// output does not depend on Go's randomized map iteration. less, if not nil,
+// orders the keys by their string form. Otherwise integer keys are ordered
+// numerically, bool keys false first and other keys by their string form.
+func sortedMapKeys(value reflect.Value, less func(a, b string) bool) []reflect.Value {
+	keys := value.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		if less != nil {
+			return less(fmt.Sprintf("%v", keys[i].Interface()), fmt.Sprintf("%v", keys[j].Interface()))
 		}
+		switch keys[i].Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return keys[i].Int() < keys[j].Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return keys[i].Uint() < keys[j].Uint()
+		case reflect.Bool:
+			return !keys[i].Bool() && keys[j].Bool()
+		}
+		return fmt.Sprintf("%v", keys[i].Interface()) < fmt.Sprintf("%v", keys[j].Interface())
+	})
+	return keys
+}
+
+// mapKeyTag returns the tag of the key nodes written for map keys of kind:
+// !!int or !!bool for integers and bools, !!str for strings. Other kinds
+// return "" as they have no natural key form.
+func mapKeyTag(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return "!!str"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return "!!int"
+	case reflect.Bool:
+		return "!!bool"
+	default:
+		return ""
+	}
+}
+
+// createOrReusePair returns the pair of originalContent holding key, or a new
+// one placed like its last pair. A new key node gets tag, or !!str if empty.
+func (u *updater) createOrReusePair(node *yaml.Node, key, tag string, originalContent []*yaml.Node, baseIndent int) (*yaml.Node, *yaml.Node) {
+	if keyNode, valueNode, found := u.findNodes(&yaml.Node{Content: originalContent}, key); found {
+		return keyNode, valueNode
+	}
+	if tag == "" {
+		tag = "!!str"
 	}
 
 	keyNode := &yaml.Node{
 		Kind:  yaml.ScalarNode,
 		Value: key,
-		Tag:   "!!str",
+		Tag:   tag,
 	}
 	valueNode := &yaml.Node{}
 
 	if len(originalContent) > 0 {
-		lastKey := originalContent[len(originalContent)-2]
-		lastValue := originalContent[len(originalContent)-1]
-		keyNode.Style = lastKey.Style
-		keyNode.Column = lastKey.Column
-		keyNode.Line = lastKey.Line
-		valueNode.Style = lastValue.Style
-		valueNode.Column = lastValue.Column
-		valueNode.Line = lastValue.Line
+		u.placeLikeLastPair(keyNode, valueNode, originalContent)
 	} else {
 		keyNode.Column = node.Column + baseIndent
 		valueNode.Column = node.Column + baseIndent
 	}
+	// Values of a flow mapping stay in flow style however it grows
+	valueNode.Style |= node.Style & yaml.FlowStyle
 
 	return keyNode, valueNode
 }
@@ -0,0 +1,2991 @@
+package yaml
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestUpdateYAMLNewKeysCopyComments(t *testing.T) {
+	type contact struct {
+		Name  string `yaml:"name"`
+		Age   int    `yaml:"age"`
+		Email string `yaml:"email"`
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		opts    Options
+		data    interface{}
+		want    string
+	}{
+		{
+			name:    "struct keys get no comments",
+			content: "# about x\nname: x # the name\nage: 1 # years\n",
+			data:    contact{Name: "x", Age: 1, Email: "e@x"},
+			want:    "# about x\nname: x # the name\nage: 1 # years\nemail: e@x\n",
+		},
+		{
+			name:    "map keys get no comments",
+			content: "# about x\nx: 1 # first\ny: 2 # last\n",
+			data:    map[string]int{"x": 1, "y": 2, "z": 3},
+			want:    "# about x\nx: 1 # first\ny: 2 # last\nz: 3\n",
+		},
+		{
+			name:    "struct keys copy the last line comment",
+			content: "# about x\nname: x # the name\nage: 1 # years\n",
+			opts:    Options{CopyLineComments: true},
+			data:    contact{Name: "x", Age: 1, Email: "e@x"},
+			want:    "# about x\nname: x # the name\nage: 1 # years\nemail: e@x # years\n",
+		},
+		{
+			name:    "map keys copy the last line comment",
+			content: "# about x\nx: 1 # first\ny: 2 # last\n",
+			opts:    Options{CopyLineComments: true},
+			data:    map[string]int{"x": 1, "y": 2, "z": 3},
+			want:    "# about x\nx: 1 # first\ny: 2 # last\nz: 3 # last\n",
+		},
+		{
+			name:    "nested head comments stay",
+			content: "a:\n  # about b\n  b: 1\n",
+			opts:    Options{CopyLineComments: true},
+			data:    map[string]interface{}{"a": map[string]interface{}{"b": 1, "c": 2}},
+			want:    "a:\n  # about b\n  b: 1\n  c: 2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAMLWithOptions([]byte(tt.content), tt.data, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyScalars(t *testing.T) {
+	type config struct {
+		Port  uint16  `yaml:"port"`
+		Big   int64   `yaml:"big"`
+		Ratio float64 `yaml:"ratio"`
+	}
+	lossy := map[string]func(reflect.Value) (string, yaml.Style){
+		"!!float": func(v reflect.Value) (string, yaml.Style) {
+			return strconv.FormatFloat(v.Float(), 'f', 2, 64), 0
+		},
+	}
+
+	tests := []struct {
+		name    string
+		opts    Options
+		data    config
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "exact values",
+			opts: Options{VerifyScalars: true},
+			data: config{Port: 8080, Big: math.MaxInt64, Ratio: 0.1},
+			want: "port: 8080\nbig: 9223372036854775807\nratio: 0.1\n",
+		},
+		{
+			name:    "float that does not round-trip",
+			opts:    Options{VerifyScalars: true, ScalarFormatters: lossy},
+			data:    config{Port: 1, Ratio: 1.0 / 3},
+			wantErr: true,
+		},
+		{
+			name: "lossy formatter without verification",
+			opts: Options{ScalarFormatters: lossy},
+			data: config{Port: 1, Ratio: 1.0 / 3},
+			want: "port: 1\nbig: 0\nratio: 0.33\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAMLWithOptions([]byte("port: 80\n"), tt.data, tt.opts)
+			if tt.wantErr {
+				if !errors.Is(err, ErrVerificationFailed) {
+					t.Fatalf("got error %v, want ErrVerificationFailed", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyOutput(t *testing.T) {
+	type config struct {
+		Name  string   `yaml:"name"`
+		Ports []int    `yaml:"ports"`
+		Tags  []string `yaml:"tags"`
+	}
+	duplicateKey := func(path string, key, value *yaml.Node) {
+		if path == "tags" {
+			key.Value = "name"
+		}
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		opts    Options
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "root column and checksum",
+			content: "name: a\nports:\n  - 1\n",
+			opts:    Options{VerifyOutput: true, RootColumn: 4, AppendChecksum: true},
+			want:    "    name: api\n    ports:\n      - 80\n      - 443\n    tags:\n      - \"1\"\n",
+		},
+		{
+			name:    "BOM and templates",
+			content: "\ufeffname: a\n{{- if .x }}\nports: []\n{{- end }}\ntags: []\n",
+			opts:    Options{VerifyOutput: true, PreserveTemplates: true, RootColumn: 2},
+			want:    "\ufeff  name: api\n{{- if .x }}\n  ports: [80, 443]\n{{- end }}\n  tags: [\"1\"]\n",
+		},
+		{
+			name:    "duplicate key",
+			content: "name: a\n",
+			opts:    Options{VerifyOutput: true, RootColumn: 2, AppendChecksum: true, OnKey: duplicateKey},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := config{Name: "api", Ports: []int{80, 443}, Tags: []string{"1"}}
+			out, err := UpdateYAMLWithOptions([]byte(tt.content), data, tt.opts)
+			if tt.wantErr {
+				if !errors.Is(err, ErrVerificationFailed) {
+					t.Fatalf("got error %v, want ErrVerificationFailed", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.opts.AppendChecksum {
+				if !VerifyChecksum(out) {
+					t.Errorf("checksum of %q does not verify", out)
+				}
+				out = stripChecksum(out)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateYAMLFlowRoot(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		data    interface{}
+		want    string
+	}{
+		{
+			name:    "changed value",
+			content: "{a: 1, b: 2}\n",
+			data:    map[string]int{"a": 3, "b": 2},
+			want:    "{a: 3, b: 2}\n",
+		},
+		{
+			name:    "added key",
+			content: "{a: 1, b: 2}\n",
+			data:    map[string]interface{}{"a": 1, "b": 2, "c": "new"},
+			want:    "{a: 1, b: 2, c: new}\n",
+		},
+		{
+			name:    "comments around the root",
+			content: "# head\n{a: 1, b: {x: 1}} # tail\n",
+			data:    map[string]interface{}{"a": 1, "b": map[string]int{"x": 2, "y": 3}},
+			want:    "# head\n{a: 1, b: {x: 2, y: 3}} # tail\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte(tt.content), tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateYAMLFoldedScalar(t *testing.T) {
+	type config struct {
+		Description string `yaml:"description"`
+		Notes       string `yaml:"notes"`
+	}
+	content := "description: >\n  old text\n  folded here\nnotes: |\n  keep\n"
+	data := config{
+		Description: "First paragraph.\n\nSecond paragraph.\n",
+		Notes:       "keep\n",
+	}
+
+	out, err := UpdateYAML([]byte(content), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "description: >\n  First paragraph.\n\n\n  Second paragraph.\n\nnotes: |\n  keep\n"
+	if string(out) != want {
+		t.Errorf("got:\n%q\nwant:\n%q", out, want)
+	}
+
+	var got config
+	if err := yaml.Unmarshal(out, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != data {
+		t.Errorf("output decodes to %+v, want %+v", got, data)
+	}
+}
+
+// TestUpdateSequenceComments guards index-based element reuse: comments stay
+// with the position, not with the item that was there.
+func TestUpdateSequenceComments(t *testing.T) {
+	content := "items:\n  # first\n  - a # one\n  # second\n  - b # two\n  - c # three\n"
+
+	tests := []struct {
+		name  string
+		items []string
+		want  string
+	}{
+		{
+			name:  "first item removed",
+			items: []string{"b", "c"},
+			want:  "items:\n  # first\n  - b # one\n  # second\n  - c # two\n",
+		},
+		{
+			name:  "last items removed",
+			items: []string{"a"},
+			want:  "items:\n  # first\n  - a # one\n",
+		},
+		{
+			name:  "item appended",
+			items: []string{"a", "b", "c", "d"},
+			want:  "items:\n  # first\n  - a # one\n  # second\n  - b # two\n  - c # three\n  - d\n",
+		},
+		{
+			name:  "items reordered",
+			items: []string{"c", "b", "a"},
+			want:  "items:\n  # first\n  - c # one\n  # second\n  - b # two\n  - a # three\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte(content), map[string][]string{"items": tt.items})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateYAMLFlowSequences(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		data    interface{}
+		opts    Options
+		want    string
+	}{
+		{
+			name:    "grown by one item",
+			content: "years: [2015, 2020]\n",
+			data:    map[string][]int{"years": {2015, 2020, 2024}},
+			want:    "years: [2015, 2020, 2024]\n",
+		},
+		{
+			// The new item takes the flow style from the sequence, not from
+			// the scalar before it, so it stays flow once the parent is block
+			name:    "new nested item after a scalar",
+			content: "m: [a]\n",
+			data:    map[string]interface{}{"m": []interface{}{"a", []string{"b", "c"}}},
+			opts:    Options{BlockStylePaths: []string{"m"}},
+			want:    "m:\n  - a\n  - [b, c]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAMLWithOptions([]byte(tt.content), tt.data, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateYAMLFlowMappings(t *testing.T) {
+	type inner struct {
+		Y int `yaml:"y"`
+	}
+	type limits struct {
+		A map[string]int `yaml:"a"`
+		B inner          `yaml:"b"`
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		data    interface{}
+		opts    Options
+		want    string
+	}{
+		{
+			name:    "third entry added",
+			content: "m: {a: 1, b: 2}\n",
+			data:    map[string]map[string]int{"m": {"a": 1, "b": 2, "c": 3}},
+			want:    "m: {a: 1, b: 2, c: 3}\n",
+		},
+		{
+			// New values take the flow style from the mapping, so they stay
+			// flow once the parent is block
+			name:    "new nested map entry",
+			content: "m: {a: {x: 1}}\n",
+			data:    map[string]interface{}{"m": map[string]map[string]int{"a": {"x": 1}, "b": {"y": 2}}},
+			opts:    Options{BlockStylePaths: []string{"m"}},
+			want:    "m:\n  a: {x: 1}\n  b: {y: 2}\n",
+		},
+		{
+			name:    "new nested struct field",
+			content: "m: {a: {x: 1}}\n",
+			data:    map[string]interface{}{"m": limits{A: map[string]int{"x": 1}, B: inner{Y: 2}}},
+			opts:    Options{BlockStylePaths: []string{"m"}},
+			want:    "m:\n  a: {x: 1}\n  b: {y: 2}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAMLWithOptions([]byte(tt.content), tt.data, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateYAMLIdempotent(t *testing.T) {
+	content, person := readTestPerson(t)
+	person.Age++
+	person.Hobbies = append(person.Hobbies, "Chess")
+	person.Details.Phones = append(person.Details.Phones, "+1 555 0100")
+
+	tests := []struct {
+		name    string
+		content string
+		data    interface{}
+	}{
+		{
+			name:    "test.yaml with appended items",
+			content: string(content),
+			data:    person,
+		},
+		{
+			name:    "new keys after a commented pair",
+			content: "a: 1 # first\nb: 2 # last\n",
+			data:    map[string]int{"a": 1, "b": 2, "c": 3, "d": 4},
+		},
+		{
+			name:    "blank lines between items",
+			content: "items:\n  - a\n\n  - b\n\n\n  - c\n",
+			data:    map[string][]string{"items": {"a", "b", "c", "d"}},
+		},
+		{
+			name:    "indentless sequences",
+			content: "items:\n- a\n- b\nnested:\n  list:\n  - x\n",
+			data:    map[string]interface{}{"items": []string{"a", "b", "c"}, "nested": map[string][]string{"list": {"x", "y"}, "more": {"z"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			once, err := UpdateYAML([]byte(tt.content), tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			twice, err := UpdateYAML(once, tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(twice) != string(once) {
+				t.Errorf("second update changed the output:\n%q\nfirst:\n%q", twice, once)
+			}
+		})
+	}
+}
+
+func TestUpdateYAMLKeepsTildeNulls(t *testing.T) {
+	type config struct {
+		Name     string                 `yaml:"name"`
+		Password *string                `yaml:"password"`
+		Proxy    interface{}            `yaml:"proxy"`
+		Mirrors  []interface{}          `yaml:"mirrors"`
+		Limits   map[string]interface{} `yaml:"limits"`
+	}
+	content := "name: x\npassword: ~\nproxy: ~ # unset\nmirrors: [~, a]\nlimits:\n  cpu: ~\n  memory: Null\n"
+	data := config{
+		Name:    "y",
+		Mirrors: []interface{}{nil, "a"},
+		Limits:  map[string]interface{}{"cpu": nil, "memory": nil},
+	}
+
+	out, err := UpdateYAML([]byte(content), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "name: y\npassword: ~\nproxy: ~ # unset\nmirrors: [~, a]\nlimits:\n  cpu: ~\n  memory: Null\n"
+	if string(out) != want {
+		t.Errorf("got:\n%q\nwant:\n%q", out, want)
+	}
+
+	out, err = UpdateYAMLWithOptions([]byte(content), data, Options{NormalizeScalars: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "~") {
+		t.Errorf("NormalizeScalars kept a ~ null:\n%s", out)
+	}
+}
+
+func TestUpdateYAMLQuoting(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		data    map[string]string
+		want    string
+	}{
+		{
+			name:    "indicators force double quotes",
+			content: "a: x\nb: y\nc: z\n",
+			data:    map[string]string{"a": "a: b", "b": "- item", "c": "#comment"},
+			want:    "a: \"a: b\"\nb: \"- item\"\nc: \"#comment\"\n",
+		},
+		{
+			name:    "control characters",
+			content: "a: x\n",
+			data:    map[string]string{"a": "bell\a"},
+			want:    "a: \"bell\\a\"\n",
+		},
+		{
+			name:    "new keys do not copy the first pair's quotes",
+			content: "a: \"x\"\n",
+			data:    map[string]string{"a": "x", "e": "ok", "f": "a: b"},
+			want:    "a: \"x\"\ne: ok\nf: \"a: b\"\n",
+		},
+		{
+			name:    "new keys in a flow mapping",
+			content: "{'a': 'x'}\n",
+			data:    map[string]string{"a": "x", "e": "ok", "f": "- item"},
+			want:    "{'a': 'x', e: ok, f: \"- item\"}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte(tt.content), tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateYAMLDeterministic(t *testing.T) {
+	content, _ := readTestPerson(t)
+	type extra struct {
+		Name   string            `yaml:"name"`
+		Inline map[string]int    `yaml:",inline"`
+		Labels map[string]string `yaml:"labels"`
+		Ports  map[int]string    `yaml:"ports"`
+	}
+	datas := map[string]interface{}{
+		"map": map[string]interface{}{
+			"name":    "Jane",
+			"zone":    "eu",
+			"labels":  map[string]string{"b": "2", "a": "1", "c": "3", "d": "4"},
+			"details": map[string]interface{}{"city": "Sofia", "zip": 1000, "floor": 3},
+		},
+		"inline map": extra{
+			Name:   "Jane",
+			Inline: map[string]int{"x": 1, "y": 2, "z": 3, "w": 4},
+			Labels: map[string]string{"tier": "web", "app": "api", "env": "prod"},
+			Ports:  map[int]string{443: "https", 80: "http", 8080: "alt"},
+		},
+	}
+
+	for name, data := range datas {
+		t.Run(name, func(t *testing.T) {
+			hashes := map[[sha256.Size]byte]bool{}
+			for i := 0; i < 100; i++ {
+				out, err := UpdateYAML(content, data, WithPruneUnknownKeys())
+				if err != nil {
+					t.Fatal(err)
+				}
+				hashes[sha256.Sum256(out)] = true
+			}
+			if len(hashes) != 1 {
+				t.Errorf("100 runs gave %d different outputs", len(hashes))
+			}
+		})
+	}
+}
+
+type testSkill struct {
+	Name  string `yaml:"name"`
+	Level string `yaml:"level"`
+}
+
+type testUniversity struct {
+	Name    string              `yaml:"name"`
+	Years   []int               `yaml:"years"`
+	Courses map[string][]string `yaml:"courses"`
+}
+
+type testDetails struct {
+	Address string   `yaml:"address"`
+	City    string   `yaml:"city"`
+	Country string   `yaml:"country"`
+	Phones  []string `yaml:"phones"`
+}
+
+type testPerson struct {
+	Name    string      `yaml:"name"`
+	Age     int         `yaml:"age"`
+	Hobbies []string    `yaml:"hobbies"`
+	Details testDetails `yaml:"details"`
+	Skills  struct {
+		Programming []testSkill `yaml:"programming"`
+		Languages   []testSkill `yaml:"languages"`
+	} `yaml:"skills"`
+	Education struct {
+		Universities []testUniversity `yaml:"universities"`
+	} `yaml:"education"`
+}
+
+// readTestPerson returns the repository's test.yaml and the person it holds.
+func readTestPerson(t *testing.T) ([]byte, testPerson) {
+	t.Helper()
+	content, err := os.ReadFile("../../test.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var person testPerson
+	if err := yaml.Unmarshal(content, &person); err != nil {
+		t.Fatal(err)
+	}
+	return content, person
+}
+
+func TestHeaderComment(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		replace bool
+		want    string
+	}{
+		{
+			name:    "no header yet",
+			content: "a: 1\n",
+			want:    "# DO NOT EDIT\n\na: 1\n",
+		},
+		{
+			name:    "keep a header attached to the first key",
+			content: "# old\na: 1\n",
+			want:    "# DO NOT EDIT\n\n# old\na: 1\n",
+		},
+		{
+			name:    "keep a separate header",
+			content: "# old\n\na: 1\n",
+			want:    "# DO NOT EDIT\n\n# old\n\na: 1\n",
+		},
+		{
+			name:    "keep an existing identical header",
+			content: "# DO NOT EDIT\n\na: 1\n",
+			want:    "# DO NOT EDIT\n\na: 1\n",
+		},
+		{
+			name:    "replace a header attached to the first key",
+			content: "# old\na: 1\n",
+			replace: true,
+			want:    "# DO NOT EDIT\n\na: 1\n",
+		},
+		{
+			name:    "replace a separate header",
+			content: "# old\n\na: 1\n",
+			replace: true,
+			want:    "# DO NOT EDIT\n\na: 1\n",
+		},
+		{
+			name:    "replace keeps the first key's own comment",
+			content: "# old\n\n# about a\na: 1\n",
+			replace: true,
+			want:    "# DO NOT EDIT\n\n# about a\na: 1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{HeaderComment: "DO NOT EDIT", ReplaceHeader: tt.replace}
+			out, err := UpdateYAMLWithOptions([]byte(tt.content), map[string]int{"a": 1}, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderTag(t *testing.T) {
+	type config struct {
+		A string `yaml:"a"`
+		B string `yaml:"b" order:"2"`
+		C string `yaml:"c" order:"1"`
+		D string `yaml:"d"`
+	}
+	data := config{A: "w", B: "x", C: "y", D: "z"}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "from scratch",
+			content: "",
+			want:    "c: y\nb: x\na: w\nd: z\n",
+		},
+		{
+			name:    "existing keys keep their place",
+			content: "d: old\n",
+			want:    "d: z\nc: y\nb: x\na: w\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte(tt.content), data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+
+	t.Run("invalid order", func(t *testing.T) {
+		type bad struct {
+			A string `yaml:"a" order:"first"`
+		}
+		if _, err := UpdateYAML(nil, bad{A: "w"}); err == nil || !strings.Contains(err.Error(), `invalid order tag "first" on field A`) {
+			t.Errorf("got error %v, want an invalid order tag error", err)
+		}
+	})
+}
+
+func TestUpdateYAMLTimestamps(t *testing.T) {
+	content := "date: 2020-01-01\ntagged: !!timestamp 2020-01-01\nname: x\n"
+
+	tests := []struct {
+		name    string
+		data    map[string]interface{}
+		want    string
+		wantTag string
+	}{
+		{
+			name:    "date string stays a timestamp",
+			data:    map[string]interface{}{"date": "2021-01-01", "tagged": "2021-02-03T04:05:06Z", "name": "x"},
+			want:    "date: 2021-01-01\ntagged: !!timestamp 2021-02-03T04:05:06Z\nname: x\n",
+			wantTag: "!!timestamp",
+		},
+		{
+			name:    "time.Time value",
+			data:    map[string]interface{}{"date": time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC), "tagged": "2020-01-01", "name": "x"},
+			want:    "date: 2022-01-02T00:00:00Z\ntagged: !!timestamp 2020-01-01\nname: x\n",
+			wantTag: "!!timestamp",
+		},
+		{
+			name:    "string that is no date",
+			data:    map[string]interface{}{"date": "soon", "tagged": "2020-01-01", "name": "x"},
+			want:    "date: soon\ntagged: !!timestamp 2020-01-01\nname: x\n",
+			wantTag: "!!str",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte(content), tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+
+			var root yaml.Node
+			if err := yaml.Unmarshal(out, &root); err != nil {
+				t.Fatal(err)
+			}
+			if tag := root.Content[0].Content[1].ShortTag(); tag != tt.wantTag {
+				t.Errorf("date is written as %s, want %s", tag, tt.wantTag)
+			}
+		})
+	}
+}
+
+func TestNormalizeScalars(t *testing.T) {
+	content := "a: yes\nb: True\nc: 1_000\nd: 0x10\ne: 'str'\nf: ~\n"
+	data := map[string]interface{}{"a": true, "b": true, "c": 1000, "d": 16, "e": "str", "f": nil}
+
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{
+			name: "original renderings kept",
+			want: content,
+		},
+		{
+			name: "normalized",
+			opts: Options{NormalizeScalars: true},
+			want: "a: true\nb: true\nc: 1000\nd: 16\ne: str\nf: null\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAMLWithOptions([]byte(content), data, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnlyNonNilPointers(t *testing.T) {
+	type patch struct {
+		Name *string `yaml:"name"`
+		Age  *int    `yaml:"age"`
+	}
+	age := 31
+	content := "name: Jane # keep\nage: 30\n"
+
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{
+			name: "nil pointers skipped",
+			opts: Options{OnlyNonNilPointers: true},
+			want: "name: Jane # keep\nage: 31\n",
+		},
+		{
+			name: "nil pointers written as null by default",
+			want: "name: null # keep\nage: 31\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAMLWithOptions([]byte(content), patch{Age: &age}, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxSequenceLen(t *testing.T) {
+	type config struct {
+		Ports []int `yaml:"ports"`
+	}
+
+	tests := []struct {
+		name    string
+		ports   int
+		wantErr bool
+	}{
+		{name: "at the limit", ports: 10},
+		{name: "over the limit", ports: 11, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := config{Ports: make([]int, tt.ports)}
+			_, err := UpdateYAMLWithOptions([]byte("ports: []\n"), data, Options{MaxSequenceLen: 10})
+			if tt.wantErr != errors.Is(err, ErrSequenceTooLong) {
+				t.Errorf("got error %v, want ErrSequenceTooLong: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+var errMarshal = errors.New("boom")
+
+type failingMarshaler struct{}
+
+func (failingMarshaler) MarshalYAML() (interface{}, error) {
+	return nil, errMarshal
+}
+
+func TestMarshalerErrors(t *testing.T) {
+	type details struct {
+		Secret failingMarshaler `yaml:"secret"`
+	}
+
+	tests := []struct {
+		name     string
+		content  string
+		data     interface{}
+		wantPath string
+	}{
+		{
+			name:    "nested field",
+			content: "details:\n  secret: x\n",
+			data: struct {
+				Details details `yaml:"details"`
+			}{},
+			wantPath: "at details.secret",
+		},
+		{
+			name:     "sequence element",
+			content:  "list: [1]\n",
+			data:     map[string][]failingMarshaler{"list": {{}}},
+			wantPath: "at list[0]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := UpdateYAML([]byte(tt.content), tt.data)
+			if !errors.Is(err, errMarshal) {
+				t.Fatalf("got error %v, want the MarshalYAML error", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantPath) {
+				t.Errorf("error %q does not name the path %q", err, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestNoExplicitCollectionTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		data    map[string]interface{}
+	}{
+		{
+			name:    "existing collections",
+			content: "a:\n  b: 1\nl:\n  - 1\n",
+			data:    map[string]interface{}{"a": map[string]int{"b": 2}, "l": []int{1, 2}},
+		},
+		{
+			name:    "new collections",
+			content: "a: 1\n",
+			data:    map[string]interface{}{"a": 1, "n": map[string]int{"x": 1}, "s": []string{"x"}},
+		},
+		{
+			name:    "scalars turned into collections",
+			content: "a: 1\nl: x\n",
+			data:    map[string]interface{}{"a": map[string]int{"b": 2}, "l": []int{1, 2}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte(tt.content), tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(out), "!!map") || strings.Contains(string(out), "!!seq") {
+				t.Errorf("output has an explicit collection tag:\n%s", out)
+			}
+		})
+	}
+}
+
+func TestUnsupportedKinds(t *testing.T) {
+	type config struct {
+		Name string `yaml:"name"`
+		Fn   func() `yaml:"fn"`
+	}
+
+	tests := []struct {
+		name     string
+		data     interface{}
+		wantPath string
+	}{
+		{
+			name:     "func field",
+			data:     config{Name: "y", Fn: func() {}},
+			wantPath: "at fn",
+		},
+		{
+			name:     "chan in a map",
+			data:     map[string]interface{}{"nested": map[string]interface{}{"ch": make(chan int)}},
+			wantPath: "at nested.ch",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := UpdateYAML([]byte("name: x\n"), tt.data)
+			if !errors.Is(err, ErrUnsupportedType) {
+				t.Fatalf("got error %v, want ErrUnsupportedType", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantPath) {
+				t.Errorf("error %q does not name the path %q", err, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestBoolStyle(t *testing.T) {
+	type flags struct {
+		A bool `yaml:"a"`
+		B bool `yaml:"b"`
+		C bool `yaml:"c"`
+		D bool `yaml:"d"`
+	}
+	content := "a: yes\nb: true\nc: on\n"
+	data := flags{A: false, B: false, C: true, D: true}
+
+	tests := []struct {
+		name  string
+		style BoolStyle
+		want  string
+	}{
+		{name: "true/false", style: TrueFalse, want: "a: false\nb: false\nc: on\nd: true\n"},
+		{name: "yes/no", style: YesNo, want: "a: no\nb: no\nc: on\nd: yes\n"},
+		{name: "on/off", style: OnOff, want: "a: off\nb: off\nc: on\nd: on\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAMLWithOptions([]byte(content), data, Options{BoolStyle: tt.style})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndentDetector(t *testing.T) {
+	detector := func([]byte) int { return 3 }
+	data := map[string]interface{}{"a": map[string]int{"b": 1}, "c": map[string][]int{"d": {1}}}
+
+	out, err := UpdateYAMLWithOptions([]byte("a:\n  b: 1\n"), data, Options{IndentDetector: detector})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "a:\n   b: 1\nc:\n   d:\n      - 1\n"; string(out) != want {
+		t.Errorf("got:\n%q\nwant:\n%q", out, want)
+	}
+}
+
+func TestSequenceItemLineComments(t *testing.T) {
+	content := "items:\n  - foo # note\n  - bar\n  - baz # last\n"
+
+	tests := []struct {
+		name  string
+		items []interface{}
+		want  string
+	}{
+		{
+			name:  "value changed",
+			items: []interface{}{"FOO", "bar", "baz"},
+			want:  "items:\n  - FOO # note\n  - bar\n  - baz # last\n",
+		},
+		{
+			name:  "list shrunk around it",
+			items: []interface{}{"FOO", "bar"},
+			want:  "items:\n  - FOO # note\n  - bar\n",
+		},
+		{
+			name:  "list grown around it",
+			items: []interface{}{"FOO", "bar", "baz", "qux"},
+			want:  "items:\n  - FOO # note\n  - bar\n  - baz # last\n  - qux\n",
+		},
+		{
+			name:  "item turned into a mapping",
+			items: []interface{}{map[string]string{"name": "foo"}, "bar", "baz"},
+			want:  "items:\n  - name: foo # note\n  - bar\n  - baz # last\n",
+		},
+		{
+			name:  "item turned into a sequence",
+			items: []interface{}{[]string{"a", "b"}, "bar", "baz"},
+			want:  "items:\n  - - a # note\n    - b\n  - bar\n  - baz # last\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte(content), map[string]interface{}{"items": tt.items})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapOfPointers(t *testing.T) {
+	content := "skills:\n  go:\n    name: Go # lang\n    level: high\n  rust:\n    name: Rust\n    level: low\n"
+	data := map[string]map[string]*testSkill{"skills": {
+		"go":   {Name: "Go", Level: "expert"},
+		"rust": nil,
+		"zig":  {Name: "Zig", Level: "new"},
+	}}
+
+	out, err := UpdateYAML([]byte(content), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "skills:\n  go:\n    name: Go # lang\n    level: expert\n  rust: null\n  zig:\n    name: Zig\n    level: new\n"
+	if string(out) != want {
+		t.Errorf("got:\n%q\nwant:\n%q", out, want)
+	}
+}
+
+func TestMergeKeyField(t *testing.T) {
+	type config struct {
+		Name string `yaml:"name"`
+		Base string `yaml:"<<"`
+	}
+
+	_, err := UpdateYAML([]byte("name: x\n"), config{Name: "y"})
+	if !errors.Is(err, ErrMergeKey) {
+		t.Fatalf("got error %v, want ErrMergeKey", err)
+	}
+	if !strings.Contains(err.Error(), "field Base") {
+		t.Errorf("error %q does not name the field", err)
+	}
+}
+
+func TestCoerceToExistingTag(t *testing.T) {
+	type config struct {
+		Port    string `yaml:"port"`
+		Replica int    `yaml:"replica"`
+		Ratio   string `yaml:"ratio"`
+		Debug   string `yaml:"debug"`
+	}
+	content := "port: 5\nreplica: \"7\"\nratio: 1.5\ndebug: true\n"
+	data := config{Port: "6", Replica: 8, Ratio: "high", Debug: "false"}
+
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{
+			name: "coerced to the file's types",
+			opts: Options{CoerceToExistingTag: true},
+			want: "port: 6\nreplica: \"8\"\nratio: high\ndebug: false\n",
+		},
+		{
+			name: "Go types by default",
+			want: "port: \"6\"\nreplica: 8\nratio: high\ndebug: \"false\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAMLWithOptions([]byte(content), data, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchema(t *testing.T) {
+	data := map[string]string{"a": "yes", "b": "on", "c": "y", "d": "12:30", "e": "plain"}
+
+	tests := []struct {
+		name   string
+		schema Schema
+		want   string
+	}{
+		{
+			name:   "YAML 1.2",
+			schema: Core12,
+			want:   "a: yes\nb: on\nc: y\nd: 12:30\ne: plain\n",
+		},
+		{
+			name:   "YAML 1.1",
+			schema: Legacy11,
+			want:   "a: \"yes\"\nb: \"on\"\nc: \"y\"\nd: \"12:30\"\ne: plain\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAMLWithOptions([]byte("a: x\n"), data, Options{Schema: tt.schema})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+
+			out, err = UpdateYAMLWithOptions([]byte("a: x\n"), map[string]bool{"a": true}, Options{Schema: tt.schema})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "a: true\n"; string(out) != want {
+				t.Errorf("bool got %q, want %q", out, want)
+			}
+		})
+	}
+}
+
+func TestByteArrays(t *testing.T) {
+	type blob struct {
+		Hash [4]byte `yaml:"hash"`
+		Raw  []byte  `yaml:"raw"`
+		Ints [2]int  `yaml:"ints"`
+	}
+	data := blob{Hash: [4]byte{1, 2, 3, 4}, Raw: []byte("hi"), Ints: [2]int{1, 2}}
+
+	out, err := UpdateYAML([]byte("hash: x\n"), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "hash: !!binary AQIDBA==\nraw: !!binary aGk=\nints:\n  - 1\n  - 2\n"
+	if string(out) != want {
+		t.Errorf("got:\n%q\nwant:\n%q", out, want)
+	}
+
+	// yaml.v3 decodes !!binary into strings
+	var got map[string]interface{}
+	if err := yaml.Unmarshal(out, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["hash"] != "\x01\x02\x03\x04" || got["raw"] != "hi" {
+		t.Errorf("output decodes to %q", got)
+	}
+}
+
+func TestAnonymousStructsInMaps(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		data    map[string]interface{}
+		want    string
+	}{
+		{
+			name:    "untagged fields use their Go names",
+			content: "a: 1\n",
+			data:    map[string]interface{}{"a": 1, "b": struct{ X int }{3}},
+			want:    "a: 1\nb:\n  X: 3\n",
+		},
+		{
+			name:    "tagged and nested",
+			content: "a:\n  x: 1 # keep\n",
+			data: map[string]interface{}{"a": struct {
+				X int `yaml:"x"`
+				Y struct {
+					Z string `yaml:"z"`
+				} `yaml:"y"`
+			}{X: 5, Y: struct {
+				Z string `yaml:"z"`
+			}{Z: "deep"}}},
+			want: "a:\n  x: 5 # keep\n  y:\n    z: deep\n",
+		},
+		{
+			name:    "pointer to an anonymous struct",
+			content: "a:\n  x: 1\n",
+			data: map[string]interface{}{"a": &struct {
+				X int `yaml:"x"`
+			}{X: 2}},
+			want: "a:\n  x: 2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte(tt.content), tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestRootColumn(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		data    map[string]interface{}
+		want    string
+	}{
+		{
+			name:    "nested blocks and block scalars",
+			content: "a: 1\nb:\n  c: |\n    text\n    more\n  l:\n    - 1\n",
+			data:    map[string]interface{}{"a": 2, "b": map[string]interface{}{"c": "text\nmore\n", "l": []int{1, 2}}},
+			want:    "    a: 2\n    b:\n      c: |\n        text\n        more\n      l:\n        - 1\n        - 2\n",
+		},
+		{
+			name:    "already indented input",
+			content: "    a: 1\n    b: 2\n",
+			data:    map[string]interface{}{"a": 2, "b": 2},
+			want:    "    a: 2\n    b: 2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAMLWithOptions([]byte(tt.content), tt.data, Options{RootColumn: 4})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestByteOrderMark(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		data    map[string]interface{}
+		want    string
+	}{
+		{
+			name:    "header comment",
+			content: "\ufeff# c\na: 1\n",
+			data:    map[string]interface{}{"a": 2},
+			want:    "\ufeff# c\na: 2\n",
+		},
+		{
+			name:    "indentation detected past the BOM",
+			content: "\ufeffa:\n    b: 1\n",
+			data:    map[string]interface{}{"a": map[string]int{"b": 2, "c": 3}},
+			want:    "\ufeffa:\n    b: 2\n    c: 3\n",
+		},
+		{
+			name:    "no BOM added",
+			content: "a: 1\n",
+			data:    map[string]interface{}{"a": 2},
+			want:    "a: 2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte(tt.content), tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnchorTag(t *testing.T) {
+	type base struct {
+		Name string `yaml:"name,anchor"`
+		Port int    `yaml:"port"`
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "new anchor",
+			content: "base:\n  port: 1\n",
+			want:    "base: &defaults\n  port: 2\n  name: defaults\n",
+		},
+		{
+			name:    "renamed anchor with an alias",
+			content: "base: &old\n  port: 1\nother: *old\n",
+			want:    "base: &defaults\n  port: 2\n  name: defaults\nother: *defaults\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := map[string]interface{}{"base": base{Name: "defaults", Port: 2}}
+			out, err := UpdateYAML([]byte(tt.content), data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+
+	t.Run("non-string field", func(t *testing.T) {
+		type bad struct {
+			Name int `yaml:"name,anchor"`
+		}
+		_, err := UpdateYAML([]byte("a: 1\n"), map[string]interface{}{"b": bad{Name: 1}})
+		if err == nil || !strings.Contains(err.Error(), "anchor field Name must be a string") {
+			t.Errorf("got error %v, want an anchor field error", err)
+		}
+	})
+}
+
+func TestCompactFlowThreshold(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		data    interface{}
+		want    string
+	}{
+		{
+			name:    "small list becomes flow, large stays block",
+			content: "small:\n  - x\nbig:\n  - x\n",
+			data:    map[string][]string{"small": {"a", "b"}, "big": {"a", "b", "c", "d", "e"}},
+			want:    "small: [a, b]\nbig:\n  - a\n  - b\n  - c\n  - d\n  - e\n",
+		},
+		{
+			name:    "small scalar mapping",
+			content: "m:\n  a: 1\n",
+			data:    map[string]interface{}{"m": map[string]int{"a": 1, "b": 2}, "n": map[string]interface{}{"l": []int{1}}},
+			want:    "m: {a: 1, b: 2}\nn:\n  l: [1]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAMLWithOptions([]byte(tt.content), tt.data, Options{CompactFlowThreshold: 3})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestFieldFilter(t *testing.T) {
+	type nested struct {
+		Beta string `yaml:"x_beta"`
+		C    string `yaml:"c"`
+	}
+	type config struct {
+		A      string `yaml:"a"`
+		Exp    string `yaml:"x_exp"`
+		Nested nested `yaml:"n"`
+	}
+	data := config{A: "new", Exp: "new", Nested: nested{Beta: "new", C: "new"}}
+
+	var paths []string
+	filter := func(path string, field reflect.StructField) bool {
+		paths = append(paths, path)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		return !strings.HasPrefix(name, "x_")
+	}
+
+	out, err := UpdateYAMLWithOptions([]byte("a: old\nx_exp: keep\nn:\n  x_beta: keep\n"), data, Options{FieldFilter: filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "a: new\nx_exp: keep\nn:\n  x_beta: keep\n  c: new\n"; string(out) != want {
+		t.Errorf("got:\n%q\nwant:\n%q", out, want)
+	}
+	if want := []string{"a", "x_exp", "n", "n.x_beta", "n.c"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("filter saw paths %q, want %q", paths, want)
+	}
+}
+
+func TestTODOPlaceholder(t *testing.T) {
+	type config struct {
+		Token interface{} `yaml:"token"`
+		Owner Placeholder `yaml:"owner"`
+		Port  int         `yaml:"port"`
+	}
+	data := config{Token: TODO("fill me"), Owner: TODO("later"), Port: 80}
+
+	out, err := UpdateYAML([]byte("token: abc\nowner: x # old\nport: 1\n"), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "token: # fill me\nowner: # later\nport: 80\n"; string(out) != want {
+		t.Errorf("got:\n%q\nwant:\n%q", out, want)
+	}
+
+	var got map[string]interface{}
+	if err := yaml.Unmarshal(out, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["token"] != nil || got["owner"] != nil {
+		t.Errorf("placeholders decode to %v and %v, want null", got["token"], got["owner"])
+	}
+}
+
+func TestSequenceIndentation(t *testing.T) {
+	data := map[string]interface{}{"a": map[string]interface{}{"b": 2, "l": []string{"x", "y"}, "m": map[string][]int{"n": {1}}}}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "dashes indented like mappings",
+			content: "a:\n    b: 1\n    l:\n      - x\n",
+			want:    "a:\n    b: 2\n    l:\n      - x\n      - y\n    m:\n        n:\n          - 1\n",
+		},
+		{
+			name:    "dashes at the key column",
+			content: "a:\n  b: 1\n  l:\n  - x\n",
+			want:    "a:\n  b: 2\n  l:\n  - x\n  - y\n  m:\n    n:\n    - 1\n",
+		},
+		{
+			name:    "dashes indented deeper than mappings",
+			content: "a:\n  b: 1\n  l:\n      - x\n",
+			want:    "a:\n  b: 2\n  l:\n      - x\n      - y\n  m:\n    n:\n        - 1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte(tt.content), data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestInlineMapWithTypedFields(t *testing.T) {
+	type config struct {
+		Name string                 `yaml:"name"`
+		Rest map[string]interface{} `yaml:",inline"`
+	}
+	data := config{Name: "typed", Rest: map[string]interface{}{"name": "from map", "port": 2, "new": true}}
+
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{
+			name: "typed field wins",
+			want: "name: typed\nport: 2\nextra: x\nnew: true\n",
+		},
+		{
+			name: "inline keys survive pruning",
+			opts: Options{PruneUnknownKeys: true},
+			want: "name: typed\nport: 2\nnew: true\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAMLWithOptions([]byte("name: a\nport: 1\nextra: x\n"), data, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestPinnedKeys(t *testing.T) {
+	content := "# pod\nspec:\n  containers: []\n  affinity: {}\nmetadata:\n  name: web # name\n  labels: {}\nkind: Pod\napiVersion: v1\n"
+
+	tests := []struct {
+		name    string
+		content string
+		opts    Options
+		want    string
+	}{
+		{
+			name:    "pinned first, rest sorted",
+			content: content,
+			opts:    Options{PinnedKeys: []string{"apiVersion", "kind", "metadata"}},
+			want:    "# pod\napiVersion: v1\nkind: Pod\nmetadata:\n  labels: {}\n  name: web # name\nspec:\n  affinity: {}\n  containers: []\n",
+		},
+		{
+			name:    "sorted only",
+			content: content,
+			opts:    Options{SortKeys: true},
+			want:    "# pod\napiVersion: v1\nkind: Pod\nmetadata:\n  labels: {}\n  name: web # name\nspec:\n  affinity: {}\n  containers: []\n",
+		},
+		{
+			name:    "first key's own comment moves with it",
+			content: "# header\n\n# about b\nb: 1\na: 2\n",
+			opts:    Options{SortKeys: true},
+			want:    "# header\n\na: 2\n# about b\nb: 1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAMLWithOptions([]byte(tt.content), map[string]interface{}{}, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestAliasKeys(t *testing.T) {
+	content := "k: &k name\n*k : 1\nother: 2\n"
+
+	out, err := UpdateYAML([]byte(content), map[string]interface{}{"name": 5, "other": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "k: &k name\n*k: 5\nother: 3\n"; string(out) != want {
+		t.Errorf("got:\n%q\nwant:\n%q", out, want)
+	}
+
+	var got map[string]interface{}
+	if err := yaml.Unmarshal(out, &got); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"k": "name", "name": 5, "other": 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("output decodes to %v, want %v", got, want)
+	}
+}
+
+func TestKeyMatcher(t *testing.T) {
+	type user struct {
+		UserName string
+		MaxConn  int `yaml:"maxConn"`
+	}
+	normalize := func(s string) string { return strings.ToLower(strings.ReplaceAll(s, "_", "")) }
+	matcher := func(a, b string) bool { return normalize(a) == normalize(b) }
+
+	out, err := UpdateYAMLWithOptions([]byte("user_name: a # keep\nmax_conn: 1\n"), user{UserName: "b", MaxConn: 2}, Options{KeyMatcher: matcher})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "user_name: b # keep\nmax_conn: 2\n"; string(out) != want {
+		t.Errorf("got:\n%q\nwant:\n%q", out, want)
+	}
+}
+
+func TestMaxChanges(t *testing.T) {
+	data := map[string]int{"a": 2, "b": 3, "c": 4}
+
+	tests := []struct {
+		name    string
+		content string
+		max     int
+		wantErr bool
+	}{
+		{name: "over the cap", content: "a: 1\nb: 1\nc: 1\n", max: 2, wantErr: true},
+		{name: "at the cap", content: "a: 1\nb: 1\nc: 1\n", max: 3},
+		{name: "unchanged values are not counted", content: "a: 2\nb: 3\n", max: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAMLWithOptions([]byte(tt.content), data, Options{MaxChanges: tt.max})
+			if tt.wantErr {
+				if !errors.Is(err, ErrTooManyChanges) || out != nil {
+					t.Fatalf("got %q, %v, want ErrTooManyChanges and no output", out, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "a: 2\nb: 3\nc: 4\n"; string(out) != want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, want)
+			}
+		})
+	}
+}
+
+func TestImmutableTag(t *testing.T) {
+	type record struct {
+		ID   string `yaml:"id,immutable"`
+		Name string `yaml:"name"`
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		data    record
+		want    string
+	}{
+		{
+			name:    "existing id kept",
+			content: "id: abc # fixed\nname: a\n",
+			data:    record{ID: "xyz", Name: "b"},
+			want:    "id: abc # fixed\nname: b\n",
+		},
+		{
+			name:    "missing id written",
+			content: "name: a\n",
+			data:    record{ID: "xyz", Name: "b"},
+			want:    "name: b\nid: xyz\n",
+		},
+		{
+			name:    "existing id kept over a zero value",
+			content: "id: abc\n",
+			data:    record{Name: "b"},
+			want:    "id: abc\nname: b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte(tt.content), tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubstitutions(t *testing.T) {
+	data := map[string]interface{}{"url": "https://${region}.example.com/${path}", "zones": []string{"${region}-a"}}
+	substitutions := map[string]string{"region": "eu"}
+
+	out, err := UpdateYAMLWithOptions([]byte("url: x\nzones: []\n"), data, Options{Substitutions: substitutions})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "url: https://eu.example.com/${path}\nzones: [eu-a]\n"; string(out) != want {
+		t.Errorf("got:\n%q\nwant:\n%q", out, want)
+	}
+
+	_, err = UpdateYAMLWithOptions([]byte("url: x\n"), data, Options{Substitutions: substitutions, FailOnUnknownSubstitution: true})
+	if !errors.Is(err, ErrUnknownSubstitution) || !strings.Contains(err.Error(), "${path} at url") {
+		t.Errorf("got error %v, want ErrUnknownSubstitution for ${path} at url", err)
+	}
+}
+
+func TestOnKey(t *testing.T) {
+	var paths, values []string
+	prefix := func(path string, key, value *yaml.Node) {
+		paths = append(paths, path)
+		values = append(values, value.Value)
+		if !strings.Contains(path, ".") {
+			key.Value = "x_" + key.Value
+		}
+	}
+	data := map[string]interface{}{"a": 2, "b": map[string]int{"c": 3}}
+
+	out, err := UpdateYAMLWithOptions([]byte("a: 1 # one\nb:\n  c: 2\n"), data, Options{OnKey: prefix})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "x_a: 2 # one\nx_b:\n  c: 3\n"; string(out) != want {
+		t.Errorf("got:\n%q\nwant:\n%q", out, want)
+	}
+	// Parents are visited first, so children see their parent's new key
+	if want := []string{"a", "b", "x_b.c"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("visited %q, want %q", paths, want)
+	}
+	if want := []string{"2", "", "3"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("saw values %q, want the updated %q", values, want)
+	}
+}
+
+func TestSequenceBlankLines(t *testing.T) {
+	content := "name: x\nitems:\n  - a\n\n  - b # note\n\n\n  # head\n  - c\nother:\n  - 1\n\n  - 2\n"
+
+	tests := []struct {
+		name string
+		data map[string]interface{}
+		want string
+	}{
+		{
+			name: "update elsewhere",
+			data: map[string]interface{}{"name": "y"},
+			want: "name: y\nitems:\n  - a\n\n  - b # note\n\n\n  # head\n  - c\nother:\n  - 1\n\n  - 2\n",
+		},
+		{
+			name: "items changed and added",
+			data: map[string]interface{}{"items": []string{"a", "B", "c", "d"}},
+			want: "name: x\nitems:\n  - a\n\n  - B # note\n\n\n  # head\n  - c\n  - d\nother:\n  - 1\n\n  - 2\n",
+		},
+		{
+			name: "items removed",
+			data: map[string]interface{}{"items": []string{"a"}},
+			want: "name: x\nitems:\n  - a\nother:\n  - 1\n\n  - 2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte(content), tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestManagedRegion(t *testing.T) {
+	region := [2]string{"BEGIN managed", "END managed"}
+
+	tests := []struct {
+		name    string
+		content string
+		data    interface{}
+		want    string
+	}{
+		{
+			name:    "top-level keys",
+			content: "a: 1\n# BEGIN managed\nb: 1\nc: 1\n# END managed\nd: 1\n",
+			data:    map[string]int{"a": 2, "b": 2, "c": 2, "d": 2, "e": 2},
+			want:    "a: 1\n# BEGIN managed\nb: 2\nc: 2\n# END managed\nd: 1\n",
+		},
+		{
+			name:    "nested region",
+			content: "outer:\n  a: 1\n  # BEGIN managed\n  b: 1\n  # END managed\n",
+			data:    map[string]map[string]int{"outer": {"a": 2, "b": 2}},
+			want:    "outer:\n  a: 1\n  # BEGIN managed\n  b: 2\n  # END managed\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAMLWithOptions([]byte(tt.content), tt.data, Options{ManagedRegion: region})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestOmitEmpty(t *testing.T) {
+	type contact struct {
+		Name   string   `yaml:"name"`
+		City   string   `yaml:"city,omitempty"`
+		Zip    int      `yaml:"zip,omitempty"`
+		Phones []string `yaml:"phones,omitempty"`
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		data    contact
+		want    string
+	}{
+		{
+			name:    "zero values removed",
+			content: "name: a\ncity: Sofia # home\nzip: 1000\nphones:\n  - \"123\"\n",
+			data:    contact{Name: "b"},
+			want:    "name: b\n",
+		},
+		{
+			name:    "zero values not added",
+			content: "name: a\n",
+			data:    contact{Name: "b"},
+			want:    "name: b\n",
+		},
+		{
+			name:    "set values written",
+			content: "name: a\ncity: Sofia # home\n",
+			data:    contact{Name: "a", City: "Plovdiv", Zip: 4000, Phones: []string{"123"}},
+			want:    "name: a\ncity: Plovdiv # home\nzip: 4000\nphones:\n  - \"123\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte(tt.content), tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendChecksum(t *testing.T) {
+	opts := Options{AppendChecksum: true}
+
+	out, err := UpdateYAMLWithOptions([]byte("a: 1\n"), map[string]int{"a": 2}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("a: 2\n"))
+	want := fmt.Sprintf("a: 2\n# sha256: %x\n", sum)
+	if string(out) != want {
+		t.Errorf("got:\n%q\nwant:\n%q", out, want)
+	}
+	if !VerifyChecksum(out) {
+		t.Errorf("checksum of %q does not verify", out)
+	}
+
+	out, err = UpdateYAMLWithOptions(out, map[string]int{"a": 3}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum = sha256.Sum256([]byte("a: 3\n"))
+	want = fmt.Sprintf("a: 3\n# sha256: %x\n", sum)
+	if string(out) != want {
+		t.Errorf("got:\n%q\nwant:\n%q", out, want)
+	}
+
+	if VerifyChecksum([]byte(strings.Replace(string(out), "a: 3", "a: 4", 1))) {
+		t.Error("tampered content verified")
+	}
+}
+
+func TestSkipDashTag(t *testing.T) {
+	type account struct {
+		Name   string `yaml:"name"`
+		Secret string `yaml:"-"`
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "secret not written",
+			content: "name: a\n",
+			want:    "name: b\n",
+		},
+		{
+			name:    "existing dash key untouched",
+			content: "name: a\n'-': keep\n",
+			want:    "name: b\n'-': keep\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte(tt.content), account{Name: "b", Secret: "hunter2"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapOfStructSequences(t *testing.T) {
+	type team struct {
+		Teams map[string][]testSkill `yaml:"teams"`
+	}
+
+	content := "teams:\n  backend:\n    # lead\n    - name: go # main\n      level: junior\n  frontend:\n    - name: ts\n      # rating\n      level: mid\n"
+
+	tests := []struct {
+		name string
+		data team
+		want string
+	}{
+		{
+			name: "values updated",
+			data: team{Teams: map[string][]testSkill{
+				"backend":  {{Name: "go", Level: "senior"}},
+				"frontend": {{Name: "ts", Level: "senior"}},
+			}},
+			want: "teams:\n  backend:\n    # lead\n    - name: go # main\n      level: senior\n  frontend:\n    - name: ts\n      # rating\n      level: senior\n",
+		},
+		{
+			name: "items and keys added",
+			data: team{Teams: map[string][]testSkill{
+				"backend":  {{Name: "go", Level: "junior"}, {Name: "sql", Level: "mid"}},
+				"frontend": {{Name: "ts", Level: "mid"}},
+				"ops":      {{Name: "k8s", Level: "junior"}},
+			}},
+			want: "teams:\n  backend:\n    # lead\n    - name: go # main\n      level: junior\n    - name: sql\n      level: mid\n  frontend:\n    - name: ts\n      # rating\n      level: mid\n  ops:\n    - name: k8s\n      level: junior\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte(content), tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestPointerFields(t *testing.T) {
+	type profile struct {
+		Name       string          `yaml:"name"`
+		Skill      *testSkill      `yaml:"skill"`
+		Mentor     *testSkill      `yaml:"mentor,omitempty"`
+		University *testUniversity `yaml:"university"`
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		data    profile
+		want    string
+	}{
+		{
+			name:    "nil pointers",
+			content: "name: a\nskill:\n  name: go\n  level: mid\nmentor:\n  name: b\n  level: senior\n",
+			data:    profile{Name: "a"},
+			want:    "name: a\nskill: null\nuniversity: null\n",
+		},
+		{
+			name:    "populated pointer",
+			content: "name: a\n# alma mater\nuniversity:\n  name: old\n  years: [2010]\n",
+			data: profile{Name: "a", University: &testUniversity{
+				Name:  "TU",
+				Years: []int{2010, 2014},
+			}},
+			want: "name: a\n# alma mater\nuniversity:\n  name: TU\n  years: [2010, 2014]\n  courses: {}\nskill: null\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte(tt.content), tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateYAMLSafe(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{name: "valid", content: "a: 1\n", want: "a: 2\n"},
+		{name: "malformed", content: "a: [1\nb: 2\n", want: "a: [1\nb: 2\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAMLSafe([]byte(tt.content), map[string]int{"a": 2})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestPruneUnknownKeys(t *testing.T) {
+	type profile struct {
+		Name    string      `yaml:"name"`
+		Details testDetails `yaml:"details"`
+	}
+
+	content := "# people\nname: a # full name\nnickname: al\n# where\ndetails:\n  # street\n  address: x\n  city: y\n  country: z\n  phones: []\n  zip: 1000\n"
+
+	tests := []struct {
+		name  string
+		prune bool
+		want  string
+	}{
+		{
+			name:  "prune",
+			prune: true,
+			want:  "# people\nname: b # full name\n# where\ndetails:\n  # street\n  address: x\n  city: y\n  country: z\n  phones: []\n",
+		},
+		{
+			name: "keep",
+			want: "# people\nname: b # full name\nnickname: al\n# where\ndetails:\n  # street\n  address: x\n  city: y\n  country: z\n  phones: []\n  zip: 1000\n",
+		},
+	}
+
+	data := profile{Name: "b", Details: testDetails{Address: "x", City: "y", Country: "z", Phones: []string{}}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAMLWithOptions([]byte(content), data, Options{PruneUnknownKeys: tt.prune})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestScalarFormatters(t *testing.T) {
+	type price struct {
+		Name   string  `yaml:"name"`
+		Amount float64 `yaml:"amount"`
+		Count  int     `yaml:"count"`
+	}
+
+	twoDecimals := func(v reflect.Value) (string, yaml.Style) {
+		return strconv.FormatFloat(v.Float(), 'f', 2, 64), 0
+	}
+
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{
+			name: "default",
+			want: "name: tea\namount: 1.5\ncount: 2\n",
+		},
+		{
+			name: "float formatter",
+			opts: []Option{WithScalarFormatter("!!float", twoDecimals)},
+			want: "name: tea\namount: 1.50\ncount: 2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte("name: tea\namount: 1\ncount: 1\n"), price{Name: "tea", Amount: 1.5, Count: 2}, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestDedupScalarSequences(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		dedup   bool
+		want    string
+	}{
+		{name: "dedup", content: "tags: []\n", dedup: true, want: "tags: [a, b]\n"},
+		{name: "dedup block", content: "tags:\n  - x\n", dedup: true, want: "tags:\n  - a\n  - b\n"},
+		{name: "keep duplicates", content: "tags: []\n", want: "tags: [a, b, a]\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := map[string][]string{"tags": {"a", "b", "a"}}
+			out, err := UpdateYAMLWithOptions([]byte(tt.content), data, Options{DedupScalarSequences: tt.dedup})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateYAMLTo(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		data    interface{}
+	}{
+		{name: "struct", content: "\ufeff# people\nname: a # n\nhobbies:\n- x\n\n- y\n", data: testPerson{Name: "b", Hobbies: []string{"x", "z"}}},
+		{name: "map", content: "b: 1\na: [1, 2]\n", data: map[string]interface{}{"a": []int{3}, "c": true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := UpdateYAML([]byte(tt.content), tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out strings.Builder
+			if err := UpdateYAMLTo(&out, []byte(tt.content), tt.data); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != string(want) {
+				t.Errorf("got:\n%q\nwant:\n%q", out.String(), want)
+			}
+		})
+	}
+
+	var out strings.Builder
+	if err := UpdateYAMLTo(&out, []byte("a: [1\n"), map[string]int{"a": 1}); err == nil {
+		t.Error("expected a parse error")
+	}
+	if out.Len() != 0 {
+		t.Errorf("wrote %q on error", out.String())
+	}
+}
+
+func TestStylePaths(t *testing.T) {
+	content := "name: a\nhobbies: [chess, go]\ndetails:\n  city: x\n  phones:\n    - \"1\"\n"
+	data := map[string]interface{}{
+		"name":    "b",
+		"hobbies": []string{"chess", "go"},
+		"details": map[string]interface{}{"city": "x", "phones": []string{"1", "2"}},
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{
+			name: "unchanged styles",
+			want: "name: b\nhobbies: [chess, go]\ndetails:\n  city: x\n  phones:\n    - \"1\"\n    - \"2\"\n",
+		},
+		{
+			name: "forced styles",
+			opts: Options{FlowStylePaths: []string{"details.phones"}, BlockStylePaths: []string{"hobbies"}},
+			want: "name: b\nhobbies:\n  - chess\n  - go\ndetails:\n  city: x\n  phones: [\"1\", \"2\"]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAMLWithOptions([]byte(content), data, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeTabs(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "tabs only",
+			content: "a:\n\tx: 1\nc:\n\td:\n\t\t- 1\n",
+			want:    "a:\n  x: 2\nc:\n  d:\n    - 1\n",
+		},
+		{
+			name:    "mixed with spaces",
+			content: "b:\n    y: 1\na:\n\tx: 1\n",
+			want:    "b:\n    y: 1\na:\n    x: 2\n",
+		},
+	}
+
+	data := map[string]interface{}{"a": map[string]int{"x": 2}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := UpdateYAML([]byte(tt.content), data); !errors.Is(err, ErrTabIndentation) {
+				t.Fatalf("err = %v, want %v", err, ErrTabIndentation)
+			}
+			out, err := UpdateYAML([]byte(tt.content), data, WithNormalizeTabs())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectIndentation(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    int
+	}{
+		{name: "empty", content: "", want: 2},
+		{name: "flat", content: "a: 1\nb: 2\n", want: 2},
+		{name: "four spaces", content: "a:\n    b: 1\n", want: 4},
+		{name: "comment first", content: "      # note\na:\n   b: 1\n", want: 3},
+		{name: "indented comment after marker", content: "---\n        # note\na:\n    b: 1\n", want: 4},
+		{name: "key and child preferred", content: "list:\n- x\na:\n    b: 1\n", want: 4},
+		{name: "indented list items", content: "list:\n  - x\n  - y\n", want: 2},
+		{name: "tabs fall back", content: "a:\n\tb: 1\n", want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectIndentation(tt.content); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyAliases(t *testing.T) {
+	type contact struct {
+		Name   string   `yaml:"name"`
+		Phones []string `yaml:"phones"`
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "old key renamed",
+			content: "name: a\n# numbers\nphone: # primary first\n  - \"1\"\n",
+			want:    "name: a\n# numbers\nphones: # primary first\n  - \"1\"\n  - \"2\"\n",
+		},
+		{
+			name:    "new key kept",
+			content: "name: a\nphones:\n  - \"1\"\n",
+			want:    "name: a\nphones:\n  - \"1\"\n  - \"2\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte(tt.content), contact{Name: "a", Phones: []string{"1", "2"}}, WithKeyAlias("phone", "phones"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmbeddedStructs(t *testing.T) {
+	type CommonMeta struct {
+		ID      string `yaml:"id"`
+		Version int    `yaml:"version"`
+	}
+	type labels struct {
+		Team string `yaml:"team"`
+	}
+	type service struct {
+		CommonMeta
+		Labels labels `yaml:",inline"`
+		Name   string `yaml:"name"`
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "existing keys",
+			content: "id: a # uuid\nversion: 1\nteam: x\nname: svc\n",
+			want:    "id: b # uuid\nversion: 2\nteam: y\nname: svc\n",
+		},
+		{
+			name:    "missing keys",
+			content: "name: svc\n",
+			want:    "name: svc\nid: b\nversion: 2\nteam: y\n",
+		},
+	}
+
+	data := service{CommonMeta: CommonMeta{ID: "b", Version: 2}, Labels: labels{Team: "y"}, Name: "svc"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte(tt.content), data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewNestedStructures(t *testing.T) {
+	type owner struct {
+		Name  string   `yaml:"name"`
+		Email []string `yaml:"email"`
+	}
+	type metadata struct {
+		Labels map[string]string `yaml:"labels"`
+		Owner  owner             `yaml:"owner"`
+	}
+	type service struct {
+		Name     string   `yaml:"name"`
+		Metadata metadata `yaml:"metadata"`
+	}
+
+	data := service{Name: "svc", Metadata: metadata{
+		Labels: map[string]string{"tier": "web"},
+		Owner:  owner{Name: "a", Email: []string{"a@x"}},
+	}}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "two spaces",
+			content: "name: svc\n",
+			want:    "name: svc\nmetadata:\n  labels:\n    tier: web\n  owner:\n    name: a\n    email:\n      - a@x\n",
+		},
+		{
+			name:    "four spaces",
+			content: "name: svc\nother:\n    x: 1\n",
+			want:    "name: svc\nother:\n    x: 1\nmetadata:\n    labels:\n        tier: web\n    owner:\n        name: a\n        email:\n            - a@x\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte(tt.content), data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnlyFillEmpty(t *testing.T) {
+	type profile struct {
+		Name    string      `yaml:"name"`
+		Age     int         `yaml:"age"`
+		Details testDetails `yaml:"details"`
+	}
+
+	content := "name: Alice # set by hand\nage:\ndetails:\n  address: \"\"\n  city: ~\n  country: BG\n  phones: []\n"
+	data := profile{Name: "Bob", Age: 30, Details: testDetails{Address: "x", City: "y", Country: "DE", Phones: []string{"1"}}}
+
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{
+			name: "fill empty",
+			opts: []Option{WithOnlyFillEmpty()},
+			want: "name: Alice # set by hand\nage: 30\ndetails:\n  address: \"x\"\n  city: y\n  country: BG\n  phones: [\"1\"]\n",
+		},
+		{
+			name: "overwrite",
+			want: "name: Bob # set by hand\nage: 30\ndetails:\n  address: \"x\"\n  city: y\n  country: DE\n  phones: [\"1\"]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte(content), data, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnumHint(t *testing.T) {
+	type logging struct {
+		Level  string `yaml:"level" enum:"low,medium,high"`
+		Format string `yaml:"format" enum:"json, text"`
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "new keys",
+			content: "other: 1\n",
+			want:    "other: 1\nlevel: high # one of: low, medium, high\nformat: json # one of: json, text\n",
+		},
+		{
+			name:    "existing keys",
+			content: "level: low\nformat: text # structured logs\n",
+			want:    "level: high # one of: low, medium, high\nformat: json # structured logs\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte(tt.content), logging{Level: "high", Format: "json"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestZeroValuePolicy(t *testing.T) {
+	type limits struct {
+		Name    string `yaml:"name"`
+		Retries int    `yaml:"retries"`
+	}
+
+	tests := []struct {
+		name    string
+		policy  ZeroValuePolicy
+		present string
+		absent  string
+	}{
+		{name: "write", policy: ZeroWrite, present: "name: a\nretries: 0\n", absent: "name: a\nretries: 0\n"},
+		{name: "omit if absent", policy: ZeroOmitIfAbsent, present: "name: a\nretries: 0\n", absent: "name: a\n"},
+		{name: "null", policy: ZeroNull, present: "name: a\nretries: null\n", absent: "name: a\nretries: null\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for content, want := range map[string]string{"name: a\nretries: 3\n": tt.present, "name: a\n": tt.absent} {
+				out, err := UpdateYAML([]byte(content), limits{Name: "a"}, WithZeroValuePolicy(tt.policy))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(out) != want {
+					t.Errorf("got:\n%q\nwant:\n%q", out, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNonStringMapKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		data    interface{}
+		want    string
+	}{
+		{
+			name:    "int keys",
+			content: "ports:\n  80: [http]\n",
+			data:    map[string]map[int][]string{"ports": {8080: {"alt"}, 443: {"https"}, 80: {"http", "web"}}},
+			want:    "ports:\n  80: [http, web]\n  443:\n    - https\n  8080:\n    - alt\n",
+		},
+		{
+			name:    "int keys from struct",
+			content: "ports: {}\n",
+			data: struct {
+				Ports map[int]string `yaml:"ports"`
+			}{map[int]string{10: "a", 2: "b"}},
+			want: "ports: {2: b, 10: a}\n",
+		},
+		{
+			name:    "bool keys",
+			content: "flags: {}\n",
+			data:    map[string]map[bool]string{"flags": {true: "on", false: "off"}},
+			want:    "flags: {false: off, true: on}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte(tt.content), tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+
+			var doc yaml.Node
+			if err := yaml.Unmarshal(out, &doc); err != nil {
+				t.Fatal(err)
+			}
+			mapping := doc.Content[0].Content[1]
+			for i := 0; i < len(mapping.Content); i += 2 {
+				if key := mapping.Content[i]; key.Tag == "!!str" {
+					t.Errorf("key %q resolves to !!str", key.Value)
+				}
+			}
+		})
+	}
+}
+
+func TestJSONStyle(t *testing.T) {
+	type plugin struct {
+		Name   string                 `yaml:"name"`
+		Config map[string]interface{} `yaml:"config" style:"json"`
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "existing key",
+			content: "name: a\nconfig: x # for the agent\n",
+			want:    "name: a\nconfig: \"{\\\"b\\\":1,\\\"c\\\":[true]}\" # for the agent\n",
+		},
+		{
+			name:    "new key",
+			content: "name: a\n",
+			want:    "name: a\nconfig: \"{\\\"b\\\":1,\\\"c\\\":[true]}\"\n",
+		},
+	}
+
+	data := plugin{Name: "a", Config: map[string]interface{}{"c": []bool{true}, "b": 1}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte(tt.content), data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+
+			var got struct {
+				Config string `yaml:"config"`
+			}
+			if err := yaml.Unmarshal(out, &got); err != nil {
+				t.Fatal(err)
+			}
+			if want := `{"b":1,"c":[true]}`; got.Config != want {
+				t.Errorf("config decodes to %q, want %q", got.Config, want)
+			}
+		})
+	}
+}
+
+func TestMapKeepsKeyPositions(t *testing.T) {
+	type config struct {
+		Env map[string]string `yaml:"env"`
+	}
+
+	content := "env:\n  ZED: z # last by name\n  APP: a\n  MID: m\n"
+	data := config{Env: map[string]string{"APP": "a2", "NEW": "n", "ZED": "z", "MID": "m2", "BETA": "b"}}
+	want := "env:\n  ZED: z # last by name\n  APP: a2\n  MID: m2\n  BETA: b\n  NEW: n\n"
+
+	out, err := UpdateYAML([]byte(content), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != want {
+		t.Errorf("got:\n%q\nwant:\n%q", out, want)
+	}
+}
+
+func TestCommentOnlyDocument(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "empty", content: "", want: "name: go\nlevel: mid\n"},
+		{name: "comments", content: "# one\n# two\n", want: "# one\n# two\n\nname: go\nlevel: mid\n"},
+		{name: "separated comments", content: "# one\n\n# two\n", want: "# one\n\n# two\n\nname: go\nlevel: mid\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte(tt.content), testSkill{Name: "go", Level: "mid"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpecialFloats(t *testing.T) {
+	type metric struct {
+		Value float64 `yaml:"value"`
+	}
+
+	tests := []struct {
+		name  string
+		value float64
+		want  string
+	}{
+		{name: "positive infinity", value: math.Inf(1), want: "value: .inf\n"},
+		{name: "negative infinity", value: math.Inf(-1), want: "value: -.inf\n"},
+		{name: "not a number", value: math.NaN(), want: "value: .nan\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte("value: 1.5\n"), metric{Value: tt.value})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+
+			var got metric
+			if err := yaml.Unmarshal(out, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Value != tt.value && !(math.IsNaN(got.Value) && math.IsNaN(tt.value)) {
+				t.Errorf("decodes to %v, want %v", got.Value, tt.value)
+			}
+		})
+	}
+}
+
+func TestTimeFields(t *testing.T) {
+	type job struct {
+		Timeout   time.Duration `yaml:"timeout"`
+		StartedAt time.Time     `yaml:"startedAt"`
+	}
+
+	data := job{Timeout: 90 * time.Second, StartedAt: time.Date(2023, 1, 2, 15, 4, 5, 0, time.UTC)}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "existing keys",
+			content: "timeout: 30s # per attempt\nstartedAt: 2020-01-01T00:00:00Z\n",
+			want:    "timeout: 1m30s # per attempt\nstartedAt: 2023-01-02T15:04:05Z\n",
+		},
+		{
+			name:    "new keys",
+			content: "name: build\n",
+			want:    "name: build\ntimeout: 1m30s\nstartedAt: 2023-01-02T15:04:05Z\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte(tt.content), data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+
+			var got job
+			if err := yaml.Unmarshal(out, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != data {
+				t.Errorf("decodes to %+v, want %+v", got, data)
+			}
+		})
+	}
+}
+
+type testLevel int
+
+func (l testLevel) MarshalYAML() (interface{}, error) {
+	return [...]string{"low", "medium", "high"}[l], nil
+}
+
+type testColor struct{ r, g, b uint8 }
+
+func (c testColor) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("#%02x%02x%02x", c.r, c.g, c.b)), nil
+}
+
+type testEndpoint struct{ host, port string }
+
+func (e testEndpoint) MarshalYAML() (interface{}, error) {
+	return map[string]string{"host": e.host, "port": e.port}, nil
+}
+
+type testSecret string
+
+func (s testSecret) MarshalYAML() (interface{}, error) {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!secret", Value: string(s)}, nil
+}
+
+type testPorts []int
+
+func (p testPorts) MarshalYAML() (interface{}, error) {
+	node := yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+	for _, port := range p {
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: strconv.Itoa(port)})
+	}
+	return node, nil
+}
+
+func TestMarshalerFields(t *testing.T) {
+	type theme struct {
+		Level    testLevel    `yaml:"level"`
+		Color    testColor    `yaml:"color"`
+		Endpoint testEndpoint `yaml:"endpoint"`
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "existing keys",
+			content: "level: low # severity\ncolor: '#000000'\nendpoint:\n  host: a\n  port: \"1\"\n",
+			want:    "level: high # severity\ncolor: '#ff8000'\nendpoint:\n  host: b\n  port: \"8080\"\n",
+		},
+		{
+			name:    "new keys",
+			content: "name: x\n",
+			want:    "name: x\nlevel: high\ncolor: \"#ff8000\"\nendpoint:\n  host: b\n  port: \"8080\"\n",
+		},
+	}
+
+	data := theme{Level: 2, Color: testColor{255, 128, 0}, Endpoint: testEndpoint{"b", "8080"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte(tt.content), data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodeMarshalers(t *testing.T) {
+	type service struct {
+		Token testSecret `yaml:"token"`
+		Ports testPorts  `yaml:"ports"`
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "existing keys",
+			content: "token: old # from vault\nports:\n  - 1\n",
+			want:    "token: !secret abc # from vault\nports: [80, 443]\n",
+		},
+		{
+			name:    "new keys",
+			content: "name: x\n",
+			want:    "name: x\ntoken: !secret abc\nports: [80, 443]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte(tt.content), service{Token: "abc", Ports: testPorts{80, 443}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndirectTimes(t *testing.T) {
+	when := time.Date(2023, 1, 2, 15, 4, 5, 0, time.UTC)
+	want := "name: x\nwhen: 2023-01-02T15:04:05Z\n"
+
+	tests := []struct {
+		name string
+		data interface{}
+	}{
+		{name: "pointer field", data: struct {
+			Name string     `yaml:"name"`
+			When *time.Time `yaml:"when"`
+		}{"x", &when}},
+		{name: "interface field", data: struct {
+			Name string      `yaml:"name"`
+			When interface{} `yaml:"when"`
+		}{"x", when}},
+		{name: "interface map value", data: map[string]interface{}{"name": "x", "when": when}},
+		{name: "pointer map value", data: map[string]interface{}{"name": "x", "when": &when}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte("name: x\n"), tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, want)
+			}
+		})
+	}
+}
+
+func TestUpdateYAMLFrom(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		data    interface{}
+	}{
+		{name: "four spaces", content: "# people\nname: a\ndetails:\n    city: x # home\n    phones:\n    - \"1\"\n", data: map[string]interface{}{"details": map[string]interface{}{"city": "y", "phones": []string{"1", "2"}, "zip": "1000"}}},
+		{name: "byte order mark", content: "\ufeffname: a # n\nhobbies:\n- x\n\n- y\n", data: testPerson{Name: "b", Hobbies: []string{"x", "z"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := UpdateYAML([]byte(tt.content), tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := UpdateYAMLFrom(iotest.OneByteReader(strings.NewReader(tt.content)), tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != string(want) {
+				t.Errorf("got:\n%q\nwant:\n%q", out, want)
+			}
+		})
+	}
+
+	errRead := errors.New("read failed")
+	if _, err := UpdateYAMLFrom(iotest.ErrReader(errRead), map[string]int{"a": 1}); !errors.Is(err, errRead) {
+		t.Errorf("err = %v, want %v", err, errRead)
+	}
+}
+
+func TestMapKeyOrder(t *testing.T) {
+	type config struct {
+		Env map[string]string `yaml:"env"`
+	}
+
+	byLength := func(a, b string) bool {
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return a < b
+	}
+	descending := func(a, b string) bool { return a > b }
+
+	tests := []struct {
+		name    string
+		content string
+		data    interface{}
+		opts    []Option
+		want    string
+	}{
+		{
+			name:    "default order",
+			content: "env:\n  MID: m\n",
+			data:    config{Env: map[string]string{"MID": "m", "CCC": "c", "A": "a", "BB": "b"}},
+			want:    "env:\n  MID: m\n  A: a\n  BB: b\n  CCC: c\n",
+		},
+		{
+			name:    "custom order",
+			content: "env:\n  MID: m\n",
+			data:    config{Env: map[string]string{"MID": "m", "CCC": "c", "A": "a", "BB": "b"}},
+			opts:    []Option{WithMapKeyOrder(descending)},
+			want:    "env:\n  MID: m\n  CCC: c\n  BB: b\n  A: a\n",
+		},
+		{
+			name:    "custom order at the root",
+			content: "zzz: 1\nb: 1\n",
+			data:    map[string]int{"zzz": 1, "b": 1, "cc": 2, "a": 2, "dddd": 2},
+			opts:    []Option{WithMapKeyOrder(byLength)},
+			want:    "zzz: 1\nb: 1\na: 2\ncc: 2\ndddd: 2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := UpdateYAML([]byte(tt.content), tt.data, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}